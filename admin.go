@@ -0,0 +1,452 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"cacing/protocol"
+)
+
+// Shortest admin token accepted by the config
+const MIN_ADMIN_TOKEN_LEN = 16
+
+// Default ban length when the request doesn't give one
+const DEFAULT_BAN = time.Hour
+
+// Admin view of a player, unlike PlayerView it has the remote address and
+// connection details. Never sent to players.
+type adminPlayer struct {
+	protocol.PlayerView
+	Room       string    `json:"room,omitempty"`
+	Connected  bool      `json:"connected"`
+	Addr       string    `json:"addr"`
+	LastActive time.Time `json:"last_active"`
+}
+
+type adminRoom struct {
+	ID         string                `json:"id"`
+	Name       string                `json:"name"`
+	Public     bool                  `json:"public"`
+	Password   bool                  `json:"password"`
+	Status     protocol.RoomStatus   `json:"status"`
+	Settings   protocol.RoomSettings `json:"settings"`
+	Tick       uint64                `json:"tick"`
+	TickAt     time.Time             `json:"tick_at"`
+	TickCost   int64                 `json:"tick_cost_us"` // last tick's simulation time
+	Players    []adminPlayer         `json:"players"`
+	Foods      int                   `json:"foods"`
+	Spectators int                   `json:"spectators"`
+}
+
+// Live state of one room, with the board
+type adminRoomState struct {
+	adminRoom
+	Snapshot protocol.RoomSnapshot `json:"snapshot"`
+}
+
+type adminBan struct {
+	Addr   string    `json:"addr"`
+	Until  time.Time `json:"until"`
+	Reason string    `json:"reason,omitempty"`
+}
+
+// Body of kick and ban, Duration like "30m" (ban only)
+type adminKickRequest struct {
+	Reason   string `json:"reason"`
+	Duration string `json:"duration"`
+}
+
+// Body of broadcast, to every player or only those of Room
+type adminBroadcastRequest struct {
+	Message string `json:"message"`
+	Room    string `json:"room"`
+}
+
+// A ban of a remote address
+type ban struct {
+	Until  time.Time
+	Reason string
+}
+
+// Register the admin API on mux, every route needs "Authorization: Bearer <token>"
+func (s *Server) registerAdmin(mux *http.ServeMux, token string) {
+	route := func(pattern string, h http.HandlerFunc) {
+		mux.Handle(pattern, adminAuth(token, false, h))
+	}
+	route("GET /admin/api/rooms", s.adminListRooms)
+	route("GET /admin/api/rooms/{id}", s.adminGetRoom)
+	route("DELETE /admin/api/rooms/{id}", s.adminCloseRoom)
+	route("PATCH /admin/api/rooms/{id}/settings", s.adminRoomSettings)
+	route("GET /admin/api/players", s.adminListPlayers)
+	route("POST /admin/api/players/{id}/kick", s.adminKick)
+	route("POST /admin/api/players/{id}/ban", s.adminBan)
+	route("GET /admin/api/bans", s.adminListBans)
+	route("DELETE /admin/api/bans/{addr}", s.adminUnban)
+	route("POST /admin/api/broadcast", s.adminBroadcast)
+
+	// browsers can't set headers on a websocket, the stream takes ?token= too
+	mux.Handle("GET /admin/api/rooms/{id}/stream", adminAuth(token, true, http.HandlerFunc(s.adminSpectate)))
+	mux.Handle("GET /admin/{$}", dashboardHandler())
+	mux.Handle("GET /admin", http.RedirectHandler("/admin/", http.StatusMovedPermanently))
+}
+
+func adminAuth(token string, allowQuery bool, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok && allowQuery {
+			given, ok = r.URL.Query().Get("token"), r.URL.Query().Has("token")
+		}
+		if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			httpLog.Warn("admin request rejected", "remote", r.RemoteAddr, "path", r.URL.Path)
+			w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+			adminError(w, http.StatusUnauthorized, "missing or wrong admin token")
+			return
+		}
+		httpLog.Info("admin request", "remote", r.RemoteAddr, "method", r.Method, "path", r.URL.Path)
+		next.ServeHTTP(w, r)
+	})
+}
+
+func adminError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
+
+// Decode a JSON body, an empty body leaves v as it is
+func decodeBody(r *http.Request, v any) error {
+	err := json.NewDecoder(http.MaxBytesReader(nil, r.Body, 1<<16)).Decode(v)
+	if errors.Is(err, io.EOF) {
+		return nil
+	}
+	return err
+}
+
+// (call under lock)
+func adminPlayerView(p *Player) adminPlayer {
+	out := adminPlayer{
+		PlayerView: playerView(p),
+		Connected:  p.Socket != nil,
+		Addr:       p.Addr,
+		LastActive: p.LastActive,
+	}
+	if p.Room != nil {
+		out.Room = p.Room.UniqeID
+	}
+	return out
+}
+
+// (call under lock)
+func adminRoomView(r *Room) adminRoom {
+	out := adminRoom{
+		ID:         r.UniqeID,
+		Name:       r.Name,
+		Public:     r.Public,
+		Password:   r.Password != nil,
+		Status:     roomStatus(r),
+		Settings:   wireSettings(r.Settings),
+		Tick:       r.Tick,
+		TickAt:     r.TickAt,
+		TickCost:   r.TickCost.Microseconds(),
+		Players:    make([]adminPlayer, 0, len(r.Players)),
+		Foods:      len(r.Foods),
+		Spectators: len(r.Spectators),
+	}
+	for _, p := range r.Players {
+		out.Players = append(out.Players, adminPlayerView(p))
+	}
+	return out
+}
+
+// GET /admin/api/rooms
+func (s *Server) adminListRooms(w http.ResponseWriter, r *http.Request) {
+	s.Lock.Lock()
+	rooms := make([]adminRoom, 0, len(s.Rooms))
+	for _, room := range s.Rooms {
+		rooms = append(rooms, adminRoomView(room))
+	}
+	s.Lock.Unlock()
+	slices.SortFunc(rooms, func(a, b adminRoom) int { return strings.Compare(a.ID, b.ID) })
+	writeJSON(w, http.StatusOK, rooms)
+}
+
+// GET /admin/api/rooms/{id}
+func (s *Server) adminGetRoom(w http.ResponseWriter, r *http.Request) {
+	s.Lock.Lock()
+	room := s.Rooms[strings.ToUpper(r.PathValue("id"))]
+	var state adminRoomState
+	if room != nil {
+		state = adminRoomState{adminRoom: adminRoomView(room), Snapshot: roomSnapshot(room)}
+	}
+	s.Lock.Unlock()
+	if room == nil {
+		adminError(w, http.StatusNotFound, "no such room")
+		return
+	}
+	writeJSON(w, http.StatusOK, state)
+}
+
+// DELETE /admin/api/rooms/{id}
+func (s *Server) adminCloseRoom(w http.ResponseWriter, r *http.Request) {
+	var req adminKickRequest
+	if err := decodeBody(r, &req); err != nil {
+		adminError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if req.Reason == "" {
+		req.Reason = "The room was closed by an operator."
+	}
+	s.Lock.Lock()
+	room := s.Rooms[strings.ToUpper(r.PathValue("id"))]
+	var jobs []writeJob
+	var spectators []*Conn
+	if room != nil {
+		jobs, spectators = s.closeRoom(room, req.Reason)
+	}
+	s.Lock.Unlock()
+	if room == nil {
+		adminError(w, http.StatusNotFound, "no such room")
+		return
+	}
+	for _, wj := range jobs {
+		_ = wj.conn.send(wj.kind, wj.msgType, wj.msg)
+	}
+	for _, c := range spectators {
+		c.closeWith(websocket.CloseNormalClosure, "room closed")
+	}
+	gameLog.Info("room closed by admin", "room", room.UniqeID, "reason", req.Reason)
+	writeJSON(w, http.StatusOK, map[string]any{"closed": room.UniqeID, "players": len(jobs)})
+}
+
+// Send every player of the room back to the menu and forget the room,
+// returns the room_closed notices to write and the spectators to close (call under lock)
+func (s *Server) closeRoom(room *Room, reason string) ([]writeJob, []*Conn) {
+	msg, _ := json.Marshal(protocol.Event{Type: protocol.EventClosed, Data: protocol.RoomClosed{Room: room.UniqeID, Reason: reason}})
+	var jobs []writeJob
+	for _, p := range room.Players {
+		p.Room = nil
+		p.Snake = nil
+		p.Sync.Resync = true
+		if p.Socket != nil {
+			jobs = append(jobs, writeJob{conn: p.Socket, msgType: websocket.TextMessage, msg: msg, kind: protocol.EventClosed})
+		}
+	}
+	room.Players = nil
+	for _, q := range room.Queue {
+		if q.Player.Socket != nil {
+			jobs = append(jobs, writeJob{conn: q.Player.Socket, msgType: websocket.TextMessage, msg: msg, kind: protocol.EventClosed})
+		}
+	}
+	return jobs, s.removeRoom(room)
+}
+
+// PATCH /admin/api/rooms/{id}/settings
+func (s *Server) adminRoomSettings(w http.ResponseWriter, r *http.Request) {
+	var req protocol.SettingsRequest
+	if err := decodeBody(r, &req); err != nil {
+		adminError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.Lock.Lock()
+	room := s.Rooms[strings.ToUpper(r.PathValue("id"))]
+	if room == nil {
+		s.Lock.Unlock()
+		adminError(w, http.StatusNotFound, "no such room")
+		return
+	}
+	settings := room.Settings.with(req)
+	if err := settings.validate(); err != nil {
+		s.Lock.Unlock()
+		adminError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	room.applySettings(settings)
+	jobs := roomEvent(room, protocol.EventSettings, wireSettings(settings))
+	s.Lock.Unlock()
+
+	for _, wj := range jobs {
+		_ = wj.conn.send(wj.kind, wj.msgType, wj.msg)
+	}
+	gameLog.Info("room settings changed by admin", "room", room.UniqeID, "settings", wireSettings(settings))
+	writeJSON(w, http.StatusOK, wireSettings(settings))
+}
+
+// The same event for every connected player of a room (call under lock)
+func roomEvent(room *Room, typ string, data any) []writeJob {
+	msg, _ := json.Marshal(protocol.Event{Type: typ, Data: data})
+	var jobs []writeJob
+	for _, p := range room.Players {
+		if p.Socket != nil {
+			jobs = append(jobs, writeJob{conn: p.Socket, msgType: websocket.TextMessage, msg: msg, kind: typ})
+		}
+	}
+	return jobs
+}
+
+// GET /admin/api/players
+func (s *Server) adminListPlayers(w http.ResponseWriter, r *http.Request) {
+	s.Lock.Lock()
+	players := make([]adminPlayer, 0, len(s.Players))
+	for _, p := range s.Players {
+		players = append(players, adminPlayerView(p))
+	}
+	s.Lock.Unlock()
+	slices.SortFunc(players, func(a, b adminPlayer) int { return a.ID - b.ID })
+	writeJSON(w, http.StatusOK, players)
+}
+
+// POST /admin/api/players/{id}/kick
+func (s *Server) adminKick(w http.ResponseWriter, r *http.Request) {
+	var req adminKickRequest
+	if err := decodeBody(r, &req); err != nil {
+		adminError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if req.Reason == "" {
+		req.Reason = "kicked by an operator"
+	}
+	p, ok := s.kickPlayer(w, r, req.Reason)
+	if ok {
+		writeJSON(w, http.StatusOK, map[string]any{"kicked": p.ID})
+	}
+}
+
+// POST /admin/api/players/{id}/ban, kicks the player and refuses its address
+func (s *Server) adminBan(w http.ResponseWriter, r *http.Request) {
+	var req adminKickRequest
+	if err := decodeBody(r, &req); err != nil {
+		adminError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	length := DEFAULT_BAN
+	if req.Duration != "" {
+		d, err := time.ParseDuration(req.Duration)
+		if err != nil || d <= 0 {
+			adminError(w, http.StatusBadRequest, "duration must be positive, like 30m or 24h")
+			return
+		}
+		length = d
+	}
+	if req.Reason == "" {
+		req.Reason = "banned by an operator"
+	}
+	p, ok := s.kickPlayer(w, r, req.Reason)
+	if !ok {
+		return
+	}
+	until := time.Now().Add(length)
+	if p.Addr != "" {
+		s.Lock.Lock()
+		s.Bans[p.Addr] = ban{Until: until, Reason: req.Reason}
+		s.Lock.Unlock()
+	}
+	httpLog.Info("address banned", "player", p.ID, "addr", p.Addr, "until", until)
+	writeJSON(w, http.StatusOK, adminBan{Addr: p.Addr, Until: until, Reason: req.Reason})
+}
+
+// Evict the player of the {id} path value and close its socket, writes the
+// error response itself when there is no such player
+func (s *Server) kickPlayer(w http.ResponseWriter, r *http.Request, reason string) (*Player, bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		adminError(w, http.StatusBadRequest, "player id must be a number")
+		return nil, false
+	}
+	s.Lock.Lock()
+	p := s.Players[id]
+	var conn *Conn
+	if p != nil {
+		conn = p.Socket
+		p.Socket = nil
+		s.evictPlayer(p)
+	}
+	s.Lock.Unlock()
+	if p == nil {
+		adminError(w, http.StatusNotFound, "no such player")
+		return nil, false
+	}
+	if conn != nil {
+		conn.closeWith(websocket.ClosePolicyViolation, reason)
+	}
+	httpLog.Info("player kicked", "player", p.ID, "reason", reason)
+	return p, true
+}
+
+// GET /admin/api/bans
+func (s *Server) adminListBans(w http.ResponseWriter, r *http.Request) {
+	s.Lock.Lock()
+	bans := make([]adminBan, 0, len(s.Bans))
+	for addr, b := range s.Bans {
+		bans = append(bans, adminBan{Addr: addr, Until: b.Until, Reason: b.Reason})
+	}
+	s.Lock.Unlock()
+	slices.SortFunc(bans, func(a, b adminBan) int { return strings.Compare(a.Addr, b.Addr) })
+	writeJSON(w, http.StatusOK, bans)
+}
+
+// DELETE /admin/api/bans/{addr}
+func (s *Server) adminUnban(w http.ResponseWriter, r *http.Request) {
+	addr := r.PathValue("addr")
+	s.Lock.Lock()
+	_, found := s.Bans[addr]
+	delete(s.Bans, addr)
+	s.Lock.Unlock()
+	if !found {
+		adminError(w, http.StatusNotFound, "no ban for that address")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"unbanned": addr})
+}
+
+// POST /admin/api/broadcast
+func (s *Server) adminBroadcast(w http.ResponseWriter, r *http.Request) {
+	var req adminBroadcastRequest
+	if err := decodeBody(r, &req); err != nil || strings.TrimSpace(req.Message) == "" {
+		adminError(w, http.StatusBadRequest, "message is required")
+		return
+	}
+	data := protocol.ServerMessage{Message: req.Message}
+
+	var jobs []writeJob
+	s.Lock.Lock()
+	if req.Room != "" {
+		room := s.Rooms[strings.ToUpper(req.Room)]
+		if room == nil {
+			s.Lock.Unlock()
+			adminError(w, http.StatusNotFound, "no such room")
+			return
+		}
+		jobs = roomEvent(room, protocol.EventMessage, data)
+	} else {
+		msg, _ := json.Marshal(protocol.Event{Type: protocol.EventMessage, Data: data})
+		for _, p := range s.Players {
+			if p.Socket != nil {
+				jobs = append(jobs, writeJob{conn: p.Socket, msgType: websocket.TextMessage, msg: msg, kind: protocol.EventMessage})
+			}
+		}
+	}
+	s.Lock.Unlock()
+
+	for _, wj := range jobs {
+		_ = wj.conn.send(wj.kind, wj.msgType, wj.msg)
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"sent": len(jobs)})
+}
+
+// Banned remote address, false once the ban ran out (call under lock)
+func (s *Server) banned(addr string) (ban, bool) {
+	b, ok := s.Bans[addr]
+	if ok && time.Now().After(b.Until) {
+		delete(s.Bans, addr)
+		return ban{}, false
+	}
+	return b, ok
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/websocket"
+
+	"cacing/protocol"
+)
+
+const testAdminToken = "test-admin-token-0123"
+
+func adminRequest(t *testing.T, s *Server, method, path, token string) *httptest.ResponseRecorder {
+	t.Helper()
+	mux := http.NewServeMux()
+	s.registerAdmin(mux, testAdminToken)
+	req := httptest.NewRequest(method, path, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAdminNeedsToken(t *testing.T) {
+	s, _ := newTestServer(t)
+	for _, token := range []string{"", "wrong", testAdminToken + "x"} {
+		if rec := adminRequest(t, s, "GET", "/admin/api/rooms", token); rec.Code != http.StatusUnauthorized {
+			t.Errorf("token %q: got %d, want 401", token, rec.Code)
+		}
+	}
+	if rec := adminRequest(t, s, "GET", "/admin/api/rooms", testAdminToken); rec.Code != http.StatusOK {
+		t.Errorf("right token: got %d, want 200", rec.Code)
+	}
+}
+
+func TestAdminKickClosesSocket(t *testing.T) {
+	s, url := newTestServer(t)
+	c := dialClient(t, url, "", protocol.ConnectRequest{Name: "kickme"})
+	c.send(t, protocol.TypeCreate, nil)
+	c.read(t)
+
+	var players []adminPlayer
+	rec := adminRequest(t, s, "GET", "/admin/api/players", testAdminToken)
+	if err := json.Unmarshal(rec.Body.Bytes(), &players); err != nil || len(players) != 1 || players[0].Room == "" {
+		t.Fatalf("players: %v %s", err, rec.Body)
+	}
+
+	if rec := adminRequest(t, s, "POST", "/admin/api/players/0/kick", testAdminToken); rec.Code != http.StatusOK {
+		t.Fatalf("kick: %d %s", rec.Code, rec.Body)
+	}
+	for {
+		if _, _, err := c.conn.ReadMessage(); err != nil {
+			break
+		}
+	}
+	s.Lock.Lock()
+	defer s.Lock.Unlock()
+	// the now empty room may already be gone
+	if room := s.Rooms[players[0].Room]; len(s.Players) != 0 || (room != nil && len(room.Players) != 0) {
+		t.Fatalf("kicked player still registered: %d players", len(s.Players))
+	}
+}
+
+func TestAdminBanBehindProxy(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.TrustedProxies = []string{"127.0.0.1"}
+	s := newServer(cfg)
+	url := serveTest(t, s)
+	t.Cleanup(func() { s.stop(context.Background()) })
+
+	// every test client shares the proxy's address, only the forwarded one differs
+	dial := func(client string) (*websocket.Conn, *http.Response, error) {
+		return websocket.DefaultDialer.Dial(url, http.Header{"X-Forwarded-For": {client}})
+	}
+	conn, _, err := dial("198.51.100.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	c := &testClient{conn: conn}
+	c.send(t, protocol.TypeConnect, protocol.ConnectRequest{Name: "troll"})
+	c.read(t)
+
+	rec := adminRequest(t, s, "POST", "/admin/api/players/0/ban", testAdminToken)
+	var b adminBan
+	if err := json.Unmarshal(rec.Body.Bytes(), &b); err != nil || b.Addr != "198.51.100.1" {
+		t.Fatalf("ban: %d %s", rec.Code, rec.Body)
+	}
+	if _, resp, err := dial("198.51.100.1"); err == nil || resp == nil || resp.StatusCode != http.StatusForbidden {
+		t.Errorf("banned client let in: %v", err)
+	}
+	other, _, err := dial("198.51.100.2")
+	if err != nil {
+		t.Fatalf("ban hit everyone behind the proxy: %v", err)
+	}
+	other.Close()
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"unicode/utf8"
+
+	"cacing/protocol"
+)
+
+// Subprotocol a client asks for to receive board frames and send inputs in binary.
+// Everything else (connect, create, join, fail, ...) stays JSON text frames.
+const SUBPROTOCOL_BINARY = "snake.bin.v1"
+
+// Opcodes, first byte of every binary frame. All integers are big endian.
+//
+// Snapshot (server -> client):
+//
+//	u8 op | u32 tick | u16 snakes | snake... | u16 foods | cell...
+//
+// Delta (server -> client):
+//
+//	u8 op | u32 tick | u32 base | u16 changed | change... |
+//	u16 added | snake... | u16 removed | u32 id... |
+//	u16 foods added | cell... | u16 foods removed | cell...
+//
+// Input (client -> server):
+//
+//	u8 op | u8 dir | [u32 tick]
+//
+// snake:  u32 id | u8 dir | u8 flags | u8 r | u8 g | u8 b | u16 body_len | u16 ping | u8 name_len | name... | u16 cells | cell...
+// change: u32 id | u8 mask | [u16 heads | cell...] | [u16 tail] | [u16 body_len] | [u8 dir] | [u8 dead] | [u16 ping] | [u8 flags]
+// cell:   u16 x | u16 y
+//
+// Names are UTF-8, cut to 255 bytes. The score of a player is its body_len,
+// the same as in the JSON views, so deltas carry it through body_len.
+const (
+	BIN_SNAPSHOT = 0x01
+	BIN_DELTA    = 0x02
+	BIN_INPUT    = 0x10
+)
+
+// Bits of the snake flags byte
+const (
+	BIN_FLAG_DEAD         = 1 << 0
+	BIN_FLAG_DISCONNECTED = 1 << 1
+	BIN_FLAG_HOST         = 1 << 2
+	BIN_FLAG_READY        = 1 << 3
+)
+
+// Bits of the delta change mask, the matching fields follow in this order
+const (
+	BIN_MASK_HEAD     = 1 << 0
+	BIN_MASK_TAIL     = 1 << 1
+	BIN_MASK_BODY_LEN = 1 << 2
+	BIN_MASK_DIR      = 1 << 3
+	BIN_MASK_DEAD     = 1 << 4
+	BIN_MASK_PING     = 1 << 5
+	BIN_MASK_FLAGS    = 1 << 6
+)
+
+var errBadBinary = errors.New("malformed binary message")
+
+// Encode a full board snapshot, players without a snake are skipped
+func encodeSnapshot(snap protocol.RoomSnapshot) []byte {
+	b := make([]byte, 0, 64+len(snap.Snakes)*32+len(snap.Foods)*4)
+	b = append(b, BIN_SNAPSHOT)
+	b = binary.BigEndian.AppendUint32(b, uint32(snap.Tick))
+
+	count := 0
+	for _, p := range snap.Snakes {
+		if p.Snake != nil {
+			count++
+		}
+	}
+	b = binary.BigEndian.AppendUint16(b, uint16(count))
+	for _, p := range snap.Snakes {
+		if p.Snake != nil {
+			b = appendSnake(b, p)
+		}
+	}
+
+	b = binary.BigEndian.AppendUint16(b, uint16(len(snap.Foods)))
+	for _, f := range snap.Foods {
+		b = appendCell(b, f.Pos)
+	}
+	return b
+}
+
+// Encode a delta built by diffFrames
+func encodeDelta(d protocol.RoomDelta) []byte {
+	b := make([]byte, 0, 64+len(d.Snakes)*16)
+	b = append(b, BIN_DELTA)
+	b = binary.BigEndian.AppendUint32(b, uint32(d.Tick))
+	b = binary.BigEndian.AppendUint32(b, uint32(d.Base))
+
+	b = binary.BigEndian.AppendUint16(b, uint16(len(d.Snakes)))
+	for _, sd := range d.Snakes {
+		var mask byte
+		if len(sd.Head) > 0 {
+			mask |= BIN_MASK_HEAD
+		}
+		if sd.Tail > 0 {
+			mask |= BIN_MASK_TAIL
+		}
+		if sd.BodyLen != nil {
+			mask |= BIN_MASK_BODY_LEN
+		}
+		if sd.Dir != nil {
+			mask |= BIN_MASK_DIR
+		}
+		if sd.Dead != nil {
+			mask |= BIN_MASK_DEAD
+		}
+		if sd.Ping != nil {
+			mask |= BIN_MASK_PING
+		}
+		if sd.Flags != nil {
+			mask |= BIN_MASK_FLAGS
+		}
+
+		b = binary.BigEndian.AppendUint32(b, uint32(sd.ID))
+		b = append(b, mask)
+		if mask&BIN_MASK_HEAD != 0 {
+			b = appendCells(b, sd.Head)
+		}
+		if mask&BIN_MASK_TAIL != 0 {
+			b = binary.BigEndian.AppendUint16(b, uint16(sd.Tail))
+		}
+		if mask&BIN_MASK_BODY_LEN != 0 {
+			b = binary.BigEndian.AppendUint16(b, uint16(*sd.BodyLen))
+		}
+		if mask&BIN_MASK_DIR != 0 {
+			b = append(b, byte(*sd.Dir))
+		}
+		if mask&BIN_MASK_DEAD != 0 {
+			b = append(b, boolByte(*sd.Dead))
+		}
+		if mask&BIN_MASK_PING != 0 {
+			b = binary.BigEndian.AppendUint16(b, clampU16(*sd.Ping))
+		}
+		if mask&BIN_MASK_FLAGS != 0 {
+			b = append(b, flagsByte(*sd.Flags, false))
+		}
+	}
+
+	b = binary.BigEndian.AppendUint16(b, uint16(len(d.Added)))
+	for _, p := range d.Added {
+		b = appendSnake(b, p)
+	}
+
+	b = binary.BigEndian.AppendUint16(b, uint16(len(d.Removed)))
+	for _, id := range d.Removed {
+		b = binary.BigEndian.AppendUint32(b, uint32(id))
+	}
+
+	b = binary.BigEndian.AppendUint16(b, uint16(len(d.FoodsAdded)))
+	for _, f := range d.FoodsAdded {
+		b = appendCell(b, f.Pos)
+	}
+	b = binary.BigEndian.AppendUint16(b, uint16(len(d.FoodsRemoved)))
+	for _, f := range d.FoodsRemoved {
+		b = appendCell(b, f.Pos)
+	}
+	return b
+}
+
+// Decode a binary client frame into the same envelope the JSON path produces
+func decodeBinaryMessage(b []byte) (protocol.Envelope, error) {
+	if len(b) == 0 {
+		return protocol.Envelope{}, errBadBinary
+	}
+	switch b[0] {
+	case BIN_INPUT:
+		if len(b) < 2 || b[1] >= DIRECTIONS {
+			return protocol.Envelope{}, errBadBinary
+		}
+		req := protocol.InputRequest{Dir: int(b[1])}
+		if len(b) >= 6 {
+			req.Tick = uint64(binary.BigEndian.Uint32(b[2:6]))
+		}
+		data, _ := json.Marshal(req)
+		return protocol.Envelope{Type: protocol.TypeInput, Data: data}, nil
+	default:
+		return protocol.Envelope{}, errBadBinary
+	}
+}
+
+func appendSnake(b []byte, p protocol.PlayerView) []byte {
+	s := p.Snake
+	b = binary.BigEndian.AppendUint32(b, uint32(p.ID))
+	b = append(b, byte(s.Dir))
+	b = append(b, flagsByte(p.Flags, s.Dead))
+	b = appendColor(b, s.Color)
+	b = binary.BigEndian.AppendUint16(b, uint16(s.BodyLen))
+	b = binary.BigEndian.AppendUint16(b, clampU16(p.Ping))
+	b = appendName(b, p.Name)
+	return appendCells(b, s.Body)
+}
+
+// u8 length and the name, cut to 255 bytes without splitting a character
+func appendName(b []byte, name string) []byte {
+	if len(name) > 0xff {
+		cut := 0xff
+		for cut > 0 && !utf8.RuneStart(name[cut]) {
+			cut--
+		}
+		name = name[:cut]
+	}
+	b = append(b, byte(len(name)))
+	return append(b, name...)
+}
+
+func appendCells(b []byte, cells []protocol.Vector2) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(cells)))
+	for _, c := range cells {
+		b = appendCell(b, c)
+	}
+	return b
+}
+
+func appendCell(b []byte, c protocol.Vector2) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(c.X))
+	return binary.BigEndian.AppendUint16(b, uint16(c.Y))
+}
+
+// "#rrggbb" -> 3 bytes, anything else is sent as white
+func appendColor(b []byte, color string) []byte {
+	if len(color) == 7 && color[0] == '#' {
+		if v, err := strconv.ParseUint(color[1:], 16, 32); err == nil {
+			return append(b, byte(v>>16), byte(v>>8), byte(v))
+		}
+	}
+	return append(b, 0xff, 0xff, 0xff)
+}
+
+// Pack the player flags into the binary flags byte
+func flagsByte(flags []string, dead bool) byte {
+	var b byte
+	if dead {
+		b |= BIN_FLAG_DEAD
+	}
+	for _, f := range flags {
+		switch f {
+		case protocol.FlagDisconnected:
+			b |= BIN_FLAG_DISCONNECTED
+		case protocol.FlagHost:
+			b |= BIN_FLAG_HOST
+		case protocol.FlagReady:
+			b |= BIN_FLAG_READY
+		}
+	}
+	return b
+}
+
+func clampU16(v int) uint16 {
+	if v > 0xffff {
+		return 0xffff
+	}
+	return uint16(v)
+}
+
+func boolByte(v bool) byte {
+	if v {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"cacing/protocol"
+)
+
+// Reads a frame the way a snake.bin.v1 client would, the layout is in binary.go
+type binReader struct {
+	b   []byte
+	err error
+}
+
+func (r *binReader) next(n int) []byte {
+	if r.err != nil || len(r.b) < n {
+		r.err = errBadBinary
+		return make([]byte, n)
+	}
+	v := r.b[:n]
+	r.b = r.b[n:]
+	return v
+}
+
+func (r *binReader) u8() int  { return int(r.next(1)[0]) }
+func (r *binReader) u16() int { return int(binary.BigEndian.Uint16(r.next(2))) }
+func (r *binReader) u32() int { return int(binary.BigEndian.Uint32(r.next(4))) }
+
+func (r *binReader) cells() []protocol.Vector2 {
+	var cells []protocol.Vector2
+	for n := r.u16(); n > 0; n-- {
+		cells = append(cells, protocol.Vector2{X: r.u16(), Y: r.u16()})
+	}
+	return cells
+}
+
+func (r *binReader) foods() []protocol.Food {
+	var foods []protocol.Food
+	for _, c := range r.cells() {
+		foods = append(foods, protocol.Food{Pos: c})
+	}
+	return foods
+}
+
+func binFlags(b int) []string {
+	var flags []string
+	for i, flag := range []string{protocol.FlagDisconnected, protocol.FlagHost, protocol.FlagReady} {
+		if b&(BIN_FLAG_DISCONNECTED<<i) != 0 {
+			flags = append(flags, flag)
+		}
+	}
+	return flags
+}
+
+func (r *binReader) snake() protocol.PlayerView {
+	p := protocol.PlayerView{ID: r.u32(), Snake: &protocol.Snake{}}
+	p.Snake.Dir = r.u8()
+	flags := r.u8()
+	p.Snake.Dead = flags&BIN_FLAG_DEAD != 0
+	p.Flags = binFlags(flags)
+	rgb := r.next(3)
+	p.Snake.Color = fmt.Sprintf("#%02x%02x%02x", rgb[0], rgb[1], rgb[2])
+	p.Snake.BodyLen = r.u16()
+	p.Score = p.Snake.BodyLen
+	p.Ping = r.u16()
+	p.Name = string(r.next(r.u8()))
+	p.Snake.Body = r.cells()
+	return p
+}
+
+func (r *binReader) snakes() []protocol.PlayerView {
+	var snakes []protocol.PlayerView
+	for n := r.u16(); n > 0; n-- {
+		snakes = append(snakes, r.snake())
+	}
+	return snakes
+}
+
+func TestBinarySnapshotRoundTrip(t *testing.T) {
+	snap := protocol.RoomSnapshot{
+		Tick: 70000,
+		Snakes: []protocol.PlayerView{
+			{ID: 1, Name: "ular", Score: 3, Ping: 42, Flags: []string{protocol.FlagHost},
+				Snake: &protocol.Snake{Body: []protocol.Vector2{{X: 3, Y: 4}, {X: 2, Y: 4}}, BodyLen: 3, Dir: 2, Color: "#12ab34"}},
+			{ID: 70000, Name: "cacing", Score: 1, Flags: []string{protocol.FlagDisconnected},
+				Snake: &protocol.Snake{Body: []protocol.Vector2{{X: 0, Y: 0}}, BodyLen: 1, Color: "#ffffff", Dead: true}},
+		},
+		Foods: []protocol.Food{{Pos: protocol.Vector2{X: 9, Y: 8}}},
+	}
+	// players without a snake are not sent
+	frame := encodeSnapshot(protocol.RoomSnapshot{Tick: snap.Tick, Snakes: append(snap.Snakes, protocol.PlayerView{ID: 5}), Foods: snap.Foods})
+
+	r := &binReader{b: frame}
+	if op := r.u8(); op != BIN_SNAPSHOT {
+		t.Fatalf("op %#x", op)
+	}
+	got := protocol.RoomSnapshot{Tick: uint64(r.u32()), Snakes: r.snakes(), Foods: r.foods()}
+	if r.err != nil || len(r.b) != 0 {
+		t.Fatalf("frame %x: err %v, %d bytes left", frame, r.err, len(r.b))
+	}
+	if !reflect.DeepEqual(got, snap) {
+		t.Errorf("got  %+v\nwant %+v", got, snap)
+	}
+}
+
+func TestBinaryDeltaRoundTrip(t *testing.T) {
+	bodyLen, dir, dead, ping := 4, 1, true, 0x1ffff
+	flags := []string{protocol.FlagReady}
+	d := protocol.RoomDelta{
+		Tick: 11,
+		Base: 10,
+		Snakes: []protocol.SnakeDelta{
+			{ID: 1, Head: []protocol.Vector2{{X: 5, Y: 5}}, Tail: 1},
+			{ID: 2, BodyLen: &bodyLen, Dir: &dir, Dead: &dead, Ping: &ping, Flags: &flags},
+		},
+		Added: []protocol.PlayerView{{ID: 3, Name: "baru", Score: 1,
+			Snake: &protocol.Snake{Body: []protocol.Vector2{{X: 1, Y: 1}}, BodyLen: 1, Color: "#000000"}}},
+		Removed:      []int{4},
+		FoodsAdded:   []protocol.Food{{Pos: protocol.Vector2{X: 7, Y: 7}}},
+		FoodsRemoved: []protocol.Food{{Pos: protocol.Vector2{X: 6, Y: 6}}},
+	}
+	frame := encodeDelta(d)
+
+	r := &binReader{b: frame}
+	if op := r.u8(); op != BIN_DELTA {
+		t.Fatalf("op %#x", op)
+	}
+	got := protocol.RoomDelta{Tick: uint64(r.u32()), Base: uint64(r.u32())}
+	for n := r.u16(); n > 0; n-- {
+		sd := protocol.SnakeDelta{ID: r.u32()}
+		mask := r.u8()
+		if mask&BIN_MASK_HEAD != 0 {
+			sd.Head = r.cells()
+		}
+		if mask&BIN_MASK_TAIL != 0 {
+			sd.Tail = r.u16()
+		}
+		if mask&BIN_MASK_BODY_LEN != 0 {
+			v := r.u16()
+			sd.BodyLen = &v
+		}
+		if mask&BIN_MASK_DIR != 0 {
+			v := r.u8()
+			sd.Dir = &v
+		}
+		if mask&BIN_MASK_DEAD != 0 {
+			v := r.u8() == 1
+			sd.Dead = &v
+		}
+		if mask&BIN_MASK_PING != 0 {
+			v := r.u16()
+			sd.Ping = &v
+		}
+		if mask&BIN_MASK_FLAGS != 0 {
+			v := binFlags(r.u8())
+			sd.Flags = &v
+		}
+		got.Snakes = append(got.Snakes, sd)
+	}
+	got.Added = r.snakes()
+	for n := r.u16(); n > 0; n-- {
+		got.Removed = append(got.Removed, r.u32())
+	}
+	got.FoodsAdded, got.FoodsRemoved = r.foods(), r.foods()
+	if r.err != nil || len(r.b) != 0 {
+		t.Fatalf("frame %x: err %v, %d bytes left", frame, r.err, len(r.b))
+	}
+
+	// pings above 65535ms are clamped
+	ping = 0xffff
+	if !reflect.DeepEqual(got, d) {
+		t.Errorf("got  %+v\nwant %+v", got, d)
+	}
+}
+
+func TestBinaryLongName(t *testing.T) {
+	name := strings.Repeat("a", 254) + "é"
+	b := appendName(nil, name)
+	if int(b[0]) != len(b)-1 || string(b[1:]) != strings.Repeat("a", 254) {
+		t.Errorf("cut name to %d bytes: %q", b[0], b[1:])
+	}
+}
+
+func TestDecodeBinaryMessage(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		frame []byte
+		want  *protocol.InputRequest
+	}{
+		{"input", []byte{BIN_INPUT, 3}, &protocol.InputRequest{Dir: 3}},
+		{"input with tick", []byte{BIN_INPUT, 1, 0, 1, 0, 2}, &protocol.InputRequest{Dir: 1, Tick: 65538}},
+		{"empty", []byte{}, nil},
+		{"short input", []byte{BIN_INPUT}, nil},
+		{"unknown direction", []byte{BIN_INPUT, DIRECTIONS}, nil},
+		{"unknown opcode", []byte{0x7f, 1}, nil},
+		{"server opcode", []byte{BIN_SNAPSHOT, 0, 0, 0, 1}, nil},
+	} {
+		env, err := decodeBinaryMessage(tc.frame)
+		if tc.want == nil {
+			if err == nil {
+				t.Errorf("%s: decoded %+v", tc.name, env)
+			}
+			continue
+		}
+		var got protocol.InputRequest
+		if err != nil || env.Type != protocol.TypeInput || json.Unmarshal(env.Data, &got) != nil || got != *tc.want {
+			t.Errorf("%s: got %+v %s (%v), want %+v", tc.name, env, env.Data, err, *tc.want)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"crypto/sha256"
+	"embed"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// Client bundles built into the binary: the plain JS client in static/ and the
+// React app, which `npm run build` in frontend/snake-frontend writes to client/dist
+//
+//go:embed static all:client
+var clientFiles embed.FS
+
+// Values of Config.Client
+const (
+	CLIENT_AUTO   = "auto" // react if it was built before go build, static otherwise
+	CLIENT_REACT  = "react"
+	CLIENT_STATIC = "static"
+	CLIENT_NONE   = "none" // websocket only
+)
+
+// Vite puts content hashed files here, they never change under the same name
+const CLIENT_ASSETS_DIR = "assets/"
+
+// Pick the files of the configured client, nil for none. A non empty dir
+// serves that directory from disk instead, for working on a client without
+// rebuilding the server.
+func clientFS(client, dir string) (fs.FS, error) {
+	if dir != "" {
+		if _, err := os.Stat(path.Join(dir, "index.html")); err != nil {
+			return nil, fmt.Errorf("client_dir: %w", err)
+		}
+		return os.DirFS(dir), nil
+	}
+
+	react, _ := fs.Sub(clientFiles, "client/dist")
+	_, err := fs.Stat(react, "index.html")
+	reactBuilt := err == nil
+
+	switch client {
+	case CLIENT_NONE:
+		return nil, nil
+	case CLIENT_STATIC:
+		return fs.Sub(clientFiles, "static")
+	case CLIENT_REACT:
+		if !reactBuilt {
+			return nil, fmt.Errorf("client %q is not built into this binary, run npm run build in frontend/snake-frontend and rebuild", client)
+		}
+		return react, nil
+	case CLIENT_AUTO:
+		if reactBuilt {
+			return react, nil
+		}
+		return fs.Sub(clientFiles, "static")
+	}
+	return nil, fmt.Errorf("unknown client %q", client)
+}
+
+// Serves a client bundle: files as they are, any other extensionless path gets
+// index.html so client side routes survive a reload
+type clientHandler struct {
+	files    fs.FS
+	embedded bool              // files can't change, cache hard and send etags
+	etags    map[string]string // by file name, embedded only
+	started  time.Time         // Last-Modified of embedded files
+}
+
+func newClientHandler(files fs.FS, embedded bool) *clientHandler {
+	h := &clientHandler{files: files, embedded: embedded, started: time.Now()}
+	if embedded {
+		h.etags = map[string]string{}
+		_ = fs.WalkDir(files, ".", func(name string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			data, err := fs.ReadFile(files, name)
+			if err != nil {
+				return err
+			}
+			sum := sha256.Sum256(data)
+			h.etags[name] = `"` + base64.RawURLEncoding.EncodeToString(sum[:12]) + `"`
+			return nil
+		})
+	}
+	return h
+}
+
+func (h *clientHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+	if name == "" {
+		name = "index.html"
+	}
+	f, err := h.files.Open(name)
+	if err == nil {
+		if info, statErr := f.Stat(); statErr != nil || info.IsDir() {
+			f.Close()
+			err = fs.ErrNotExist
+		}
+	}
+	if err != nil {
+		// a missing asset is a real 404, anything else is a client side route
+		if path.Ext(name) != "" {
+			http.NotFound(w, r)
+			return
+		}
+		name = "index.html"
+		if f, err = h.files.Open(name); err != nil {
+			http.NotFound(w, r)
+			return
+		}
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	content, ok := f.(io.ReadSeeker)
+	if err != nil || !ok {
+		httpLog.Error("can't serve client file", "file", name, "err", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	modTime := info.ModTime()
+	switch {
+	case !h.embedded:
+		w.Header().Set("Cache-Control", "no-cache")
+	case strings.HasPrefix(name, CLIENT_ASSETS_DIR):
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	default:
+		// index.html and unhashed files, revalidate against the etag
+		w.Header().Set("Cache-Control", "no-cache")
+	}
+	if h.embedded {
+		w.Header().Set("ETag", h.etags[name])
+		modTime = h.started
+	}
+	http.ServeContent(w, r, name, modTime, content)
+}
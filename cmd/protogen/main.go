@@ -0,0 +1,209 @@
+// Command protogen exports the types of the protocol package as TypeScript
+// declarations and as a JSON Schema document.
+//
+//	go run ./cmd/protogen -ts frontend/snake-frontend/src/api/protocol.ts -schema protocol/schema.json
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+
+	"cacing/protocol"
+)
+
+var rawMessage = reflect.TypeOf(json.RawMessage{})
+
+// One exported field of a struct
+type field struct {
+	Name     string
+	Type     reflect.Type
+	Optional bool
+}
+
+func main() {
+	tsOut := flag.String("ts", "", "write TypeScript declarations to this file")
+	schemaOut := flag.String("schema", "", "write a JSON Schema document to this file")
+	flag.Parse()
+
+	if *tsOut == "" && *schemaOut == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *tsOut != "" {
+		if err := os.WriteFile(*tsOut, []byte(typescript()), 0o644); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *schemaOut != "" {
+		out, err := json.MarshalIndent(schema(), "", "  ")
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := os.WriteFile(*schemaOut, append(out, '\n'), 0o644); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+// Exported fields of a struct with their JSON names
+func fields(t reflect.Type) []field {
+	var out []field
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, opts, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		out = append(out, field{Name: name, Type: f.Type, Optional: strings.Contains(opts, "omitempty")})
+	}
+	return out
+}
+
+// An omitted pointer field is just optional, not nullable
+func optionalElem(f field) reflect.Type {
+	if f.Optional && f.Type.Kind() == reflect.Pointer {
+		return f.Type.Elem()
+	}
+	return f.Type
+}
+
+func enumNames() []string {
+	names := make([]string, 0, len(protocol.Enums))
+	for name := range protocol.Enums {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func typescript() string {
+	var b strings.Builder
+	b.WriteString("// Code generated by cmd/protogen from the protocol package. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&b, "export const PROTOCOL_VERSION = %d;\n", protocol.Version)
+	fmt.Fprintf(&b, "export const PROTOCOL_MIN_VERSION = %d;\n", protocol.MinVersion)
+
+	for _, name := range enumNames() {
+		values := make([]string, 0, len(protocol.Enums[name]))
+		for _, v := range protocol.Enums[name] {
+			values = append(values, fmt.Sprintf("%q", v))
+		}
+		fmt.Fprintf(&b, "\nexport type %s = %s;\n", name, strings.Join(values, " | "))
+	}
+
+	for _, v := range protocol.Types {
+		t := reflect.TypeOf(v)
+		fmt.Fprintf(&b, "\nexport interface %s {\n", t.Name())
+		for _, f := range fields(t) {
+			opt := ""
+			if f.Optional {
+				opt = "?"
+			}
+			fmt.Fprintf(&b, "    %s%s: %s;\n", f.Name, opt, tsType(optionalElem(f)))
+		}
+		b.WriteString("}\n")
+	}
+	return b.String()
+}
+
+func tsType(t reflect.Type) string {
+	if t == rawMessage {
+		return "unknown"
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		return tsType(t.Elem()) + " | null"
+	case reflect.Slice, reflect.Array:
+		elem := tsType(t.Elem())
+		if strings.Contains(elem, " ") {
+			elem = "(" + elem + ")"
+		}
+		return elem + "[]"
+	case reflect.Map:
+		return "Record<string, " + tsType(t.Elem()) + ">"
+	case reflect.Struct:
+		return t.Name()
+	case reflect.Interface:
+		return "unknown"
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "number"
+	}
+	log.Fatalf("protogen: unsupported type %s", t)
+	return ""
+}
+
+func schema() map[string]any {
+	defs := map[string]any{}
+	for _, name := range enumNames() {
+		defs[name] = map[string]any{"type": "string", "enum": protocol.Enums[name]}
+	}
+	for _, v := range protocol.Types {
+		t := reflect.TypeOf(v)
+		props := map[string]any{}
+		required := []string{}
+		for _, f := range fields(t) {
+			props[f.Name] = schemaType(optionalElem(f))
+			if !f.Optional {
+				required = append(required, f.Name)
+			}
+		}
+		defs[t.Name()] = map[string]any{
+			"type":                 "object",
+			"properties":           props,
+			"required":             required,
+			"additionalProperties": false,
+		}
+	}
+	return map[string]any{
+		"$schema":          "https://json-schema.org/draft/2020-12/schema",
+		"title":            "snake-game-ws protocol",
+		"protocol_version": protocol.Version,
+		"$defs":            defs,
+	}
+}
+
+func schemaType(t reflect.Type) map[string]any {
+	if t == rawMessage {
+		return map[string]any{}
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		return map[string]any{"anyOf": []any{schemaType(t.Elem()), map[string]any{"type": "null"}}}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": schemaType(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": schemaType(t.Elem())}
+	case reflect.Struct:
+		return map[string]any{"$ref": "#/$defs/" + t.Name()}
+	case reflect.Interface:
+		return map[string]any{}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	}
+	log.Fatalf("protogen: unsupported type %s", t)
+	return nil
+}
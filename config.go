@@ -0,0 +1,426 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Prefix of the environment variables, -player-timeout is SNAKE_PLAYER_TIMEOUT
+const ENV_PREFIX = "SNAKE_"
+
+// Everything ops can tune without recompiling. Values come from, in order of
+// precedence: command-line flags, SNAKE_* environment variables, the config
+// file (-config / SNAKE_CONFIG) and the defaults below.
+type Config struct {
+	Host            string   `json:"host"`
+	Port            int      `json:"port"`
+	ShutdownTimeout Duration `json:"shutdown_timeout"`
+	Client          string   `json:"client"`
+	ClientDir       string   `json:"client_dir"`
+
+	AdminToken string `json:"admin_token"`
+
+	LogFormat string   `json:"log_format"`
+	LogLevel  string   `json:"log_level"`
+	LogLevels []string `json:"log_levels"`
+
+	TLSCert          string `json:"tls_cert"`
+	TLSKey           string `json:"tls_key"`
+	TLSSelfSigned    bool   `json:"tls_self_signed"`
+	TLSCacheDir      string `json:"tls_cache_dir"`
+	HTTPRedirectPort int    `json:"http_redirect_port"`
+
+	ArenaWidth   int      `json:"arena_width"`
+	ArenaHeight  int      `json:"arena_height"`
+	TickInterval Duration `json:"tick_interval"`
+	RoomCapacity int      `json:"room_capacity"`
+	ReadyQuorum  int      `json:"ready_quorum"`
+	Countdown    Duration `json:"start_countdown"`
+
+	PingInterval    Duration `json:"ping_interval"`
+	PongWait        Duration `json:"pong_wait"`
+	InputGrace      Duration `json:"input_grace"`
+	DisconnectGrace Duration `json:"disconnect_grace"`
+	SessionTTL      Duration `json:"session_ttl"`
+
+	PlayerTimeout          Duration `json:"player_timeout"`
+	CleanupInterval        Duration `json:"cleanup_interval"`
+	EvictionReportInterval Duration `json:"eviction_report_interval"`
+	MaxPlayers             int      `json:"max_players"`
+	MaxRooms               int      `json:"max_rooms"`
+
+	AllowedOrigins    []string `json:"allowed_origins"`
+	TrustedProxies    []string `json:"trusted_proxies"`
+	ReadBufferSize    int      `json:"read_buffer_size"`
+	WriteBufferSize   int      `json:"write_buffer_size"`
+	EnableCompression bool     `json:"enable_compression"`
+	Subprotocols      []string `json:"subprotocols"`
+	MaxMessageSize    int64    `json:"max_message_size"`
+}
+
+// time.Duration written as "150ms", "5m" in config files and -print-config
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	*d = Duration(v)
+	return err
+}
+
+func defaultConfig() Config {
+	up := defaultUpgraderConfig()
+	return Config{
+		Port:                   8080,
+		ShutdownTimeout:        Duration(SHUTDOWN_TIMEOUT),
+		Client:                 CLIENT_AUTO,
+		LogFormat:              "text",
+		LogLevel:               "info",
+		ArenaWidth:             ARENA_SIZEX,
+		ArenaHeight:            ARENA_SIZEY,
+		TickInterval:           Duration(TICK_INTERVAL),
+		RoomCapacity:           ROOM_CAPACITY,
+		ReadyQuorum:            READY_QUORUM,
+		Countdown:              Duration(START_COUNTDOWN),
+		PingInterval:           Duration(PING_INTERVAL),
+		PongWait:               Duration(PONG_WAIT),
+		InputGrace:             Duration(INPUT_GRACE),
+		DisconnectGrace:        Duration(DISCONNECT_GRACE),
+		SessionTTL:             Duration(SESSION_TTL),
+		PlayerTimeout:          Duration(PLAYER_TIMEOUT),
+		CleanupInterval:        Duration(CLEANUP_INTERVAL),
+		EvictionReportInterval: Duration(EVICTION_REPORT_INTERVAL),
+		MaxPlayers:             MAX_PLAYERS,
+		MaxRooms:               MAX_ROOMS,
+		AllowedOrigins:         up.AllowedOrigins,
+		ReadBufferSize:         up.ReadBufferSize,
+		WriteBufferSize:        up.WriteBufferSize,
+		EnableCompression:      up.EnableCompression,
+		Subprotocols:           up.Subprotocols,
+		MaxMessageSize:         up.MaxMessageSize,
+	}
+}
+
+// Comma separated list flag
+type stringList struct{ list *[]string }
+
+func (l stringList) String() string {
+	if l.list == nil {
+		return ""
+	}
+	return strings.Join(*l.list, ",")
+}
+
+func (l stringList) Set(v string) error {
+	*l.list = nil
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*l.list = append(*l.list, item)
+		}
+	}
+	return nil
+}
+
+// Register one flag per config field, bound to cfg
+func (cfg *Config) flags(fs *flag.FlagSet) {
+	fs.StringVar(&cfg.Host, "host", cfg.Host, "interface to listen on, empty for all")
+	fs.IntVar(&cfg.Port, "port", cfg.Port, "port to listen on")
+	fs.StringVar(&cfg.Client, "client", cfg.Client, "embedded client to serve on /: auto, react, static or none")
+	fs.StringVar(&cfg.ClientDir, "client-dir", cfg.ClientDir, "serve the client from this directory instead (development)")
+	fs.StringVar(&cfg.AdminToken, "admin-token", cfg.AdminToken, "bearer token of /admin/api, the admin API is off when empty (prefer SNAKE_ADMIN_TOKEN)")
+	fs.StringVar(&cfg.LogFormat, "log-format", cfg.LogFormat, "log output: text or json")
+	fs.StringVar(&cfg.LogLevel, "log-level", cfg.LogLevel, "default log level: debug, info, warn or error")
+	fs.Var(stringList{&cfg.LogLevels}, "log-levels", "comma separated levels per subsystem, like ws=debug,game=warn (subsystems: "+strings.Join(LOG_SUBSYSTEMS, ", ")+")")
+	fs.StringVar(&cfg.TLSCert, "tls-cert", cfg.TLSCert, "certificate file (PEM), serves wss:// together with -tls-key")
+	fs.StringVar(&cfg.TLSKey, "tls-key", cfg.TLSKey, "private key file (PEM) of -tls-cert")
+	fs.BoolVar(&cfg.TLSSelfSigned, "tls-self-signed", cfg.TLSSelfSigned, "development only: serve wss:// with a generated self-signed certificate")
+	fs.StringVar(&cfg.TLSCacheDir, "tls-cache-dir", cfg.TLSCacheDir, "where the self-signed certificate is kept (default: user cache dir)")
+	fs.IntVar(&cfg.HTTPRedirectPort, "http-redirect-port", cfg.HTTPRedirectPort, "with TLS, also listen for plain HTTP here and redirect to HTTPS (0 = off)")
+	fs.DurationVar((*time.Duration)(&cfg.ShutdownTimeout), "shutdown-timeout", time.Duration(cfg.ShutdownTimeout), "how long running matches may go on after SIGINT/SIGTERM")
+
+	fs.IntVar(&cfg.ArenaWidth, "arena-width", cfg.ArenaWidth, "arena width of new rooms, in cells")
+	fs.IntVar(&cfg.ArenaHeight, "arena-height", cfg.ArenaHeight, "arena height of new rooms, in cells")
+	fs.DurationVar((*time.Duration)(&cfg.TickInterval), "tick-interval", time.Duration(cfg.TickInterval), "game tick interval")
+	fs.IntVar(&cfg.RoomCapacity, "room-capacity", cfg.RoomCapacity, "players per room unless create asks for fewer or more")
+	fs.IntVar(&cfg.ReadyQuorum, "ready-quorum", cfg.ReadyQuorum, "percent of the players in a lobby that must be ready to start the countdown")
+	fs.DurationVar((*time.Duration)(&cfg.Countdown), "start-countdown", time.Duration(cfg.Countdown), "countdown between the lobby and the match")
+
+	fs.DurationVar((*time.Duration)(&cfg.PingInterval), "ping-interval", time.Duration(cfg.PingInterval), "interval of websocket pings")
+	fs.DurationVar((*time.Duration)(&cfg.PongWait), "pong-wait", time.Duration(cfg.PongWait), "drop a connection silent for this long")
+	fs.DurationVar((*time.Duration)(&cfg.InputGrace), "input-grace", time.Duration(cfg.InputGrace), "longest window for a late input to change the last move")
+	fs.DurationVar((*time.Duration)(&cfg.DisconnectGrace), "disconnect-grace", time.Duration(cfg.DisconnectGrace), "how long the snake of a disconnected player stays frozen")
+	fs.DurationVar((*time.Duration)(&cfg.SessionTTL), "session-ttl", time.Duration(cfg.SessionTTL), "lifetime of a session token")
+
+	fs.DurationVar((*time.Duration)(&cfg.PlayerTimeout), "player-timeout", time.Duration(cfg.PlayerTimeout), "forget disconnected players after this long")
+	fs.DurationVar((*time.Duration)(&cfg.CleanupInterval), "cleanup-interval", time.Duration(cfg.CleanupInterval), "interval of the cleanup service")
+	fs.DurationVar((*time.Duration)(&cfg.EvictionReportInterval), "eviction-report-interval", time.Duration(cfg.EvictionReportInterval), "interval of the eviction report log")
+	fs.IntVar(&cfg.MaxPlayers, "max-players", cfg.MaxPlayers, "most players known at once")
+	fs.IntVar(&cfg.MaxRooms, "max-rooms", cfg.MaxRooms, "most rooms at once")
+
+	fs.Var(stringList{&cfg.AllowedOrigins}, "allowed-origins", "comma separated origins allowed besides same-origin (\"*\" for any)")
+	fs.Var(stringList{&cfg.TrustedProxies}, "trusted-proxies", "comma separated addresses or CIDRs of reverse proxies whose X-Forwarded-For names the client")
+	fs.IntVar(&cfg.ReadBufferSize, "read-buffer-size", cfg.ReadBufferSize, "websocket read buffer size")
+	fs.IntVar(&cfg.WriteBufferSize, "write-buffer-size", cfg.WriteBufferSize, "websocket write buffer size")
+	fs.BoolVar(&cfg.EnableCompression, "enable-compression", cfg.EnableCompression, "negotiate permessage-deflate")
+	fs.Var(stringList{&cfg.Subprotocols}, "subprotocols", "comma separated websocket subprotocols offered")
+	fs.Int64Var(&cfg.MaxMessageSize, "max-message-size", cfg.MaxMessageSize, "largest client message in bytes")
+}
+
+// Build the config from defaults, config file, environment and args (without the program name).
+// printConfig is set when -print-config was given.
+func loadConfig(args []string) (cfg Config, printConfig bool, err error) {
+	cfg = defaultConfig()
+	fs := flag.NewFlagSet("snake", flag.ContinueOnError)
+	cfg.flags(fs)
+	configPath := fs.String("config", os.Getenv(ENV_PREFIX+"CONFIG"), "config file (.json, .yaml/.yml or .toml)")
+	fs.BoolVar(&printConfig, "print-config", false, "print the effective config as JSON and exit")
+
+	// first pass only to find -config, the real parse comes last so flags win
+	probe := flag.NewFlagSet("probe", flag.ContinueOnError)
+	probe.SetOutput(io.Discard)
+	probePath := probe.String("config", *configPath, "")
+	probe.Bool("print-config", false, "")
+	(&Config{}).flags(probe)
+	_ = probe.Parse(args)
+
+	if *probePath != "" {
+		values, err := readConfigFile(*probePath)
+		if err != nil {
+			return cfg, false, err
+		}
+		for key, value := range values {
+			name := strings.ReplaceAll(key, "_", "-")
+			if name == "config" || name == "print-config" || fs.Lookup(name) == nil {
+				return cfg, false, fmt.Errorf("%s: unknown setting %q", *probePath, key)
+			}
+			if err := fs.Set(name, value); err != nil {
+				return cfg, false, fmt.Errorf("%s: %s: %w", *probePath, key, err)
+			}
+		}
+	}
+
+	var envErr error
+	fs.VisitAll(func(f *flag.Flag) {
+		if f.Name == "config" {
+			return
+		}
+		env := ENV_PREFIX + strings.ToUpper(strings.ReplaceAll(f.Name, "-", "_"))
+		if v, ok := os.LookupEnv(env); ok && envErr == nil {
+			if err := fs.Set(f.Name, v); err != nil {
+				envErr = fmt.Errorf("%s: %w", env, err)
+			}
+		}
+	})
+	if envErr != nil {
+		return cfg, false, envErr
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return cfg, false, err
+	}
+	return cfg, printConfig, cfg.validate()
+}
+
+// Read a flat config file into setting name -> value.
+// YAML and TOML files may only hold top level "key: value" / "key = value"
+// pairs, lists as [a, b] (or "- item" lines in YAML).
+func readConfigFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		var raw map[string]any
+		if err := json.Unmarshal(data, &raw); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		values := make(map[string]string, len(raw))
+		for key, v := range raw {
+			values[key] = settingString(v)
+		}
+		return values, nil
+	case ".yaml", ".yml":
+		return parseFlatFile(path, string(data), ":")
+	case ".toml":
+		return parseFlatFile(path, string(data), "=")
+	}
+	return nil, fmt.Errorf("%s: unknown config format, use .json, .yaml, .yml or .toml", path)
+}
+
+func settingString(v any) string {
+	switch v := v.(type) {
+	case []any:
+		items := make([]string, 0, len(v))
+		for _, item := range v {
+			items = append(items, settingString(item))
+		}
+		return strings.Join(items, ",")
+	case float64:
+		return fmt.Sprint(int64(v))
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func parseFlatFile(path, data, sep string) (map[string]string, error) {
+	values := map[string]string{}
+	listKey := ""
+	for i, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(stripComment(line))
+		if line == "" {
+			continue
+		}
+		// YAML block list item belonging to the last "key:" without value
+		if item, ok := strings.CutPrefix(line, "- "); ok && sep == ":" && listKey != "" {
+			if values[listKey] != "" {
+				values[listKey] += ","
+			}
+			values[listKey] += unquote(strings.TrimSpace(item))
+			continue
+		}
+		key, value, ok := strings.Cut(line, sep)
+		if !ok || strings.HasPrefix(line, "[") {
+			return nil, fmt.Errorf("%s:%d: expected key%svalue, got %q", path, i+1, sep, line)
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		listKey = ""
+		if value == "" {
+			listKey = key
+		}
+		if strings.HasPrefix(value, "[") && strings.HasSuffix(value, "]") {
+			var items []string
+			for _, item := range strings.Split(value[1:len(value)-1], ",") {
+				if item = unquote(strings.TrimSpace(item)); item != "" {
+					items = append(items, item)
+				}
+			}
+			value = strings.Join(items, ",")
+		}
+		values[key] = unquote(value)
+	}
+	return values, nil
+}
+
+func stripComment(line string) string {
+	inQuote := byte(0)
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case inQuote != 0 && c == inQuote:
+			inQuote = 0
+		case inQuote == 0 && (c == '"' || c == '\''):
+			inQuote = c
+		case inQuote == 0 && c == '#':
+			return line[:i]
+		}
+	}
+	return line
+}
+
+func unquote(v string) string {
+	if len(v) >= 2 && (v[0] == '"' || v[0] == '\'') && v[len(v)-1] == v[0] {
+		return v[1 : len(v)-1]
+	}
+	return v
+}
+
+// Copy safe to print or log, secrets are masked but it still shows they are set
+func (cfg Config) redacted() Config {
+	if cfg.AdminToken != "" {
+		cfg.AdminToken = "redacted"
+	}
+	return cfg
+}
+
+// Check values that would break the server instead of just tuning it
+func (cfg Config) validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+	check(cfg.Port > 0 && cfg.Port < 65536, "port must be 1-65535, got %d", cfg.Port)
+	check(cfg.Client == CLIENT_AUTO || cfg.Client == CLIENT_REACT || cfg.Client == CLIENT_STATIC || cfg.Client == CLIENT_NONE,
+		"client must be auto, react, static or none, got %q", cfg.Client)
+	check(cfg.AdminToken == "" || len(cfg.AdminToken) >= MIN_ADMIN_TOKEN_LEN, "admin_token must be at least %d characters", MIN_ADMIN_TOKEN_LEN)
+	check(cfg.LogFormat == "text" || cfg.LogFormat == "json", "log_format must be text or json, got %q", cfg.LogFormat)
+	if _, err := parseLevel(cfg.LogLevel); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := parseSubsystemLevels(cfg.LogLevels); err != nil {
+		errs = append(errs, err)
+	}
+	check((cfg.TLSCert == "") == (cfg.TLSKey == ""), "tls_cert and tls_key go together")
+	check(cfg.TLSCert == "" || !cfg.TLSSelfSigned, "tls_self_signed can't be used with tls_cert")
+	check(cfg.HTTPRedirectPort == 0 || cfg.tls(), "http_redirect_port needs tls_cert/tls_key or tls_self_signed")
+	check(cfg.HTTPRedirectPort >= 0 && cfg.HTTPRedirectPort < 65536 && cfg.HTTPRedirectPort != cfg.Port,
+		"http_redirect_port must be 1-65535 and differ from port, got %d", cfg.HTTPRedirectPort)
+	check(cfg.ShutdownTimeout >= 0, "shutdown_timeout can't be negative")
+	if err := (RoomSettings{cfg.ArenaWidth, cfg.ArenaHeight, time.Duration(cfg.TickInterval), cfg.RoomCapacity, cfg.ReadyQuorum}).validate(); err != nil {
+		errs = append(errs, err)
+	}
+	check(cfg.Countdown >= 0 && time.Duration(cfg.Countdown) <= MAX_START_COUNTDOWN, "start_countdown must be 0-%v, got %v", MAX_START_COUNTDOWN, time.Duration(cfg.Countdown))
+	check(cfg.PingInterval > 0, "ping_interval must be positive")
+	check(cfg.PongWait > cfg.PingInterval, "pong_wait (%v) must be longer than ping_interval (%v)", time.Duration(cfg.PongWait), time.Duration(cfg.PingInterval))
+	check(cfg.InputGrace >= 0 && cfg.InputGrace < cfg.TickInterval, "input_grace must be between 0 and tick_interval")
+	check(cfg.DisconnectGrace >= 0, "disconnect_grace can't be negative")
+	check(cfg.SessionTTL > 0, "session_ttl must be positive")
+	check(cfg.PlayerTimeout > 0, "player_timeout must be positive")
+	check(cfg.CleanupInterval > 0, "cleanup_interval must be positive")
+	check(cfg.EvictionReportInterval > 0, "eviction_report_interval must be positive")
+	check(cfg.MaxPlayers > 0, "max_players must be positive")
+	check(cfg.MaxRooms > 0, "max_rooms must be positive")
+	if _, err := parseTrustedProxies(cfg.TrustedProxies); err != nil {
+		errs = append(errs, err)
+	}
+	check(cfg.ReadBufferSize >= 0 && cfg.WriteBufferSize >= 0, "buffer sizes can't be negative")
+	check(cfg.MaxMessageSize >= 256, "max_message_size must be at least 256 bytes")
+	return errors.Join(errs...)
+}
+
+// Address for http.ListenAndServe
+func (cfg Config) addr() string {
+	return fmt.Sprintf("%s:%d", cfg.Host, cfg.Port)
+}
+
+// Address to show to people, localhost when listening on every interface
+func (cfg Config) publicAddr() string {
+	host := cfg.Host
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "localhost"
+	}
+	return net.JoinHostPort(host, strconv.Itoa(cfg.Port))
+}
+
+// Serves wss:// and https://
+func (cfg Config) tls() bool {
+	return cfg.TLSCert != "" || cfg.TLSSelfSigned
+}
+
+func (cfg Config) upgrader() UpgraderConfig {
+	return UpgraderConfig{
+		AllowedOrigins:    cfg.AllowedOrigins,
+		ReadBufferSize:    cfg.ReadBufferSize,
+		WriteBufferSize:   cfg.WriteBufferSize,
+		EnableCompression: cfg.EnableCompression,
+		Subprotocols:      cfg.Subprotocols,
+		MaxMessageSize:    cfg.MaxMessageSize,
+	}
+}
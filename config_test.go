@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeConfig(t *testing.T, name, data string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestConfigFileFormats(t *testing.T) {
+	want := []string{"https://a.test", "https://b#c.test"}
+	for name, data := range map[string]string{
+		"snake.json": `{"port": 9001, "tick_interval": "80ms", "log_format": "json",
+			"allowed_origins": ["https://a.test", "https://b#c.test"]}`,
+		"snake.yaml": `# server
+port: 9001
+tick_interval: 80ms   # faster
+log_format: "json"
+allowed_origins:
+  - https://a.test
+  - 'https://b#c.test' # quoted, the # stays
+`,
+		"snake.yml": `port: 9001
+tick_interval: "80ms"
+log_format: 'json'
+allowed_origins: [https://a.test, "https://b#c.test"]
+`,
+		"snake.toml": `# server
+port = 9001
+tick_interval = "80ms"
+log_format = "json" # comment
+allowed_origins = ["https://a.test", 'https://b#c.test']
+`,
+	} {
+		cfg, _, err := loadConfig([]string{"-config", writeConfig(t, name, data)})
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if cfg.Port != 9001 || time.Duration(cfg.TickInterval) != 80*time.Millisecond || cfg.LogFormat != "json" ||
+			!slices.Equal(cfg.AllowedOrigins, want) {
+			t.Errorf("%s: port %d, tick %v, log %q, origins %q", name, cfg.Port, cfg.TickInterval, cfg.LogFormat, cfg.AllowedOrigins)
+		}
+	}
+}
+
+func TestConfigFileErrors(t *testing.T) {
+	for name, data := range map[string]string{
+		"unknown.yaml":  "no_such_setting: 1\n",
+		"unknown.json":  `{"prot": 80}`,
+		"section.toml":  "[server]\nport = 80\n",
+		"no_value.toml": "port 80\n",
+		"bad.yaml":      "port: eighty\n",
+		"snake.ini":     "port=80\n",
+	} {
+		if _, _, err := loadConfig([]string{"-config", writeConfig(t, name, data)}); err == nil {
+			t.Errorf("%s: no error", name)
+		}
+	}
+	_, _, err := loadConfig([]string{"-config", writeConfig(t, "typo.yaml", "prot: 80\n")})
+	if err == nil || !strings.Contains(err.Error(), `"prot"`) {
+		t.Errorf("unknown key not named: %v", err)
+	}
+}
+
+func TestConfigPrecedence(t *testing.T) {
+	path := writeConfig(t, "snake.toml", "port = 9001\narena_width = 40\nlog_level = \"warn\"\n")
+
+	cfg, _, err := loadConfig([]string{"-config", path})
+	if err != nil || cfg.Port != 9001 || cfg.ArenaWidth != 40 {
+		t.Fatalf("file: %v %d %d", err, cfg.Port, cfg.ArenaWidth)
+	}
+	if def := defaultConfig(); cfg.TickInterval != def.TickInterval {
+		t.Errorf("default lost: %v", cfg.TickInterval)
+	}
+
+	t.Setenv("SNAKE_PORT", "9002")
+	t.Setenv("SNAKE_LOG_LEVEL", "debug")
+	cfg, _, err = loadConfig([]string{"-config", path})
+	if err != nil || cfg.Port != 9002 || cfg.LogLevel != "debug" || cfg.ArenaWidth != 40 {
+		t.Fatalf("env over file: %v %d %q %d", err, cfg.Port, cfg.LogLevel, cfg.ArenaWidth)
+	}
+
+	cfg, _, err = loadConfig([]string{"-config", path, "-port", "9003"})
+	if err != nil || cfg.Port != 9003 || cfg.LogLevel != "debug" {
+		t.Fatalf("flag over env: %v %d %q", err, cfg.Port, cfg.LogLevel)
+	}
+
+	// the config file itself can come from the environment too
+	t.Setenv("SNAKE_CONFIG", path)
+	t.Setenv("SNAKE_PORT", "")
+	os.Unsetenv("SNAKE_PORT")
+	cfg, _, err = loadConfig(nil)
+	if err != nil || cfg.Port != 9001 {
+		t.Fatalf("SNAKE_CONFIG: %v %d", err, cfg.Port)
+	}
+}
+
+func TestPrintConfigHidesSecrets(t *testing.T) {
+	cfg, _, err := loadConfig([]string{"-admin-token", "s3cret-admin-token"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, _ := json.Marshal(cfg.redacted())
+	if strings.Contains(string(out), "s3cret") || !strings.Contains(string(out), `"admin_token":"redacted"`) {
+		t.Errorf("printed config: %s", out)
+	}
+	if cfg.AdminToken != "s3cret-admin-token" {
+		t.Error("redacting changed the config itself")
+	}
+}
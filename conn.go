@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/binary"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Default heartbeat timings, the server sends a ping every PING_INTERVAL and
+// drops the connection when nothing (pong or message) arrived for PONG_WAIT
+const PING_INTERVAL = 20 * time.Second
+const PONG_WAIT = 60 * time.Second
+
+// A single write may not block longer than this, so half-open sockets fail fast
+const WRITE_WAIT = 10 * time.Second
+
+// Websocket connection that is safe to write from the handler and the game loop
+type Conn struct {
+	*websocket.Conn
+	writeLock sync.Mutex
+	rtt       atomic.Int64 // last measured round trip, in nanoseconds
+	metrics   *Metrics
+}
+
+func newConn(ws *websocket.Conn, metrics *Metrics) *Conn {
+	return &Conn{Conn: ws, metrics: metrics}
+}
+
+// Write one message, serialized with every other writer of this connection
+func (c *Conn) Write(msgType int, data []byte) error {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+	c.SetWriteDeadline(time.Now().Add(WRITE_WAIT))
+	err := c.WriteMessage(msgType, data)
+	if err != nil {
+		c.metrics.WriteErrors.Add(1)
+	} else {
+		c.metrics.BytesSent.Add(uint64(len(data)))
+	}
+	return err
+}
+
+// Write one message of the given protocol type (response data type or event)
+func (c *Conn) send(typ string, msgType int, data []byte) error {
+	c.metrics.messageOut(typ)
+	return c.Write(msgType, data)
+}
+
+// Say goodbye with a close frame, then close the connection
+func (c *Conn) closeWith(code int, reason string) {
+	msg := websocket.FormatCloseMessage(code, reason)
+	_ = c.WriteControl(websocket.CloseMessage, msg, time.Now().Add(WRITE_WAIT))
+	_ = c.Close()
+}
+
+// Last measured round trip time, zero until the first pong arrives
+func (c *Conn) RTT() time.Duration {
+	return time.Duration(c.rtt.Load())
+}
+
+// Send a ping carrying the send time, the pong echoes it back
+func (c *Conn) ping() error {
+	payload := binary.BigEndian.AppendUint64(nil, uint64(time.Now().UnixNano()))
+	return c.WriteControl(websocket.PingMessage, payload, time.Now().Add(WRITE_WAIT))
+}
+
+// Measure the round trip from a pong payload, returns false for pongs we didn't ask for
+func (c *Conn) pong(payload string) (time.Duration, bool) {
+	if len(payload) != 8 {
+		return 0, false
+	}
+	sent := int64(binary.BigEndian.Uint64([]byte(payload)))
+	rtt := time.Since(time.Unix(0, sent))
+	if rtt < 0 {
+		return 0, false
+	}
+	c.rtt.Store(int64(rtt))
+	return rtt, true
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"cacing/protocol"
+)
+
+// Admin dashboard, a single page on top of /admin/api
+//
+//go:embed dashboard/index.html
+var dashboardPage []byte
+
+// GET /admin/, the page itself holds no data, it asks for the token and calls the API
+func dashboardHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("X-Frame-Options", "DENY")
+		w.Write(dashboardPage)
+	})
+}
+
+// GET /admin/api/rooms/{id}/stream, read-only websocket getting broadcast_room
+// every tick of the room until it closes
+func (s *Server) adminSpectate(w http.ResponseWriter, r *http.Request) {
+	id := strings.ToUpper(r.PathValue("id"))
+	s.Lock.Lock()
+	_, found := s.Rooms[id]
+	s.Lock.Unlock()
+	if !found {
+		adminError(w, http.StatusNotFound, "no such room")
+		return
+	}
+
+	ws, err := s.Upgrade.Upgrade(w, r, nil)
+	if err != nil {
+		httpLog.Warn("spectator upgrade failed", "remote", r.RemoteAddr, "err", err)
+		return
+	}
+	conn := newConn(ws, s.Metrics)
+	defer conn.Close()
+	conn.SetReadLimit(s.MaxMessageSize)
+
+	// the room may have ended during the upgrade
+	s.Lock.Lock()
+	s.Sockets[conn] = true
+	room := s.Rooms[id]
+	var first []byte
+	if room != nil {
+		if room.Spectators == nil {
+			room.Spectators = map[*Conn]bool{}
+		}
+		room.Spectators[conn] = true
+		first, _ = json.Marshal(protocol.Event{Type: protocol.EventRoom, Data: roomSnapshot(room)})
+	}
+	s.Lock.Unlock()
+	defer func() {
+		s.Lock.Lock()
+		delete(s.Sockets, conn)
+		if room != nil {
+			delete(room.Spectators, conn)
+		}
+		s.Lock.Unlock()
+	}()
+	if room == nil {
+		conn.closeWith(websocket.CloseNormalClosure, "room closed")
+		return
+	}
+	gameLog.Info("spectator joined", "room", id, "remote", r.RemoteAddr)
+
+	// same heartbeat as players, so a dashboard that vanished gets dropped
+	conn.SetReadDeadline(time.Now().Add(s.PongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(s.PongWait))
+	})
+	stopPing := make(chan struct{})
+	defer close(stopPing)
+	go s.pingLoop(conn, stopPing)
+
+	_ = conn.send(protocol.EventRoom, websocket.TextMessage, first)
+	// nothing to read, just notice when the dashboard goes away
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			return
+		}
+	}
+}
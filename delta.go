@@ -0,0 +1,171 @@
+package main
+
+import (
+	"slices"
+
+	"cacing/protocol"
+)
+
+// Every KEYFRAME_INTERVAL ticks a full snapshot is sent even to clients that are in sync
+const KEYFRAME_INTERVAL = 20
+
+// Per-client delta state, the baseline is the last tick the client was sent
+type clientSync struct {
+	Delta    bool   // client asked for deltas on connect
+	LastTick uint64 // last tick sent to this client
+	Resync   bool   // next frame must be a full snapshot
+}
+
+// State of one snake as it was last broadcasted
+type snakeFrame struct {
+	Body    []Vector2
+	BodyLen int
+	Dir     int
+	Dead    bool
+	Ping    int
+	Flags   []string
+}
+
+// State of a room as it was last broadcasted, base for the next delta
+type roomFrame struct {
+	Tick   uint64
+	Snakes map[int]snakeFrame
+	Foods  []Vector2
+}
+
+// Capture the current state of the room (call under lock)
+func captureFrame(room *Room) *roomFrame {
+	f := &roomFrame{
+		Tick:   room.Tick,
+		Snakes: make(map[int]snakeFrame, len(room.Players)),
+		Foods:  make([]Vector2, 0, len(room.Foods)),
+	}
+	for _, p := range room.Players {
+		if p.Snake == nil {
+			continue
+		}
+		f.Snakes[p.ID] = snakeFrame{
+			Body:    append([]Vector2(nil), p.Snake.Body...),
+			BodyLen: p.Snake.BodyLen,
+			Dir:     p.Snake.Direction,
+			Dead:    p.Snake.Dead,
+			Ping:    pingMillis(p),
+			Flags:   playerFlags(p),
+		}
+	}
+	for _, food := range room.Foods {
+		f.Foods = append(f.Foods, food.Position)
+	}
+	return f
+}
+
+// Build the delta that turns prev into cur for the room
+func diffFrames(prev, cur *roomFrame, room *Room) protocol.RoomDelta {
+	d := protocol.RoomDelta{Tick: cur.Tick, Base: prev.Tick, Snakes: []protocol.SnakeDelta{}}
+
+	for _, p := range room.Players {
+		now, ok := cur.Snakes[p.ID]
+		if !ok {
+			continue
+		}
+		old, ok := prev.Snakes[p.ID]
+		if !ok {
+			d.Added = append(d.Added, playerView(p))
+			continue
+		}
+
+		sd := protocol.SnakeDelta{ID: p.ID}
+		changed := false
+		heads, tail, ok := diffBody(old.Body, now.Body)
+		if !ok {
+			// body can't be expressed as head/tail changes, send it as a new snake
+			d.Removed = append(d.Removed, p.ID)
+			d.Added = append(d.Added, playerView(p))
+			continue
+		}
+		if len(heads) > 0 || tail > 0 {
+			sd.Head, sd.Tail = wireVectors(heads), tail
+			changed = true
+		}
+		if old.BodyLen != now.BodyLen {
+			sd.BodyLen = &now.BodyLen
+			changed = true
+		}
+		if old.Dir != now.Dir {
+			sd.Dir = &now.Dir
+			changed = true
+		}
+		if old.Dead != now.Dead {
+			sd.Dead = &now.Dead
+			changed = true
+		}
+		if old.Ping != now.Ping {
+			sd.Ping = &now.Ping
+			changed = true
+		}
+		if !slices.Equal(old.Flags, now.Flags) {
+			flags := append([]string{}, now.Flags...)
+			sd.Flags = &flags
+			changed = true
+		}
+		if changed {
+			d.Snakes = append(d.Snakes, sd)
+		}
+	}
+
+	for id := range prev.Snakes {
+		if _, ok := cur.Snakes[id]; !ok {
+			d.Removed = append(d.Removed, id)
+		}
+	}
+
+	for _, pos := range cur.Foods {
+		if !containsPos(prev.Foods, pos) {
+			d.FoodsAdded = append(d.FoodsAdded, protocol.Food{Pos: wireVector(pos)})
+		}
+	}
+	for _, pos := range prev.Foods {
+		if !containsPos(cur.Foods, pos) {
+			d.FoodsRemoved = append(d.FoodsRemoved, protocol.Food{Pos: wireVector(pos)})
+		}
+	}
+	return d
+}
+
+// Find how many cells were pushed at the head and dropped at the tail.
+// Returns ok=false when cur isn't old moved by one step, that is at most one
+// cell added in front and any number removed at the back.
+func diffBody(old, cur []Vector2) (heads []Vector2, tail int, ok bool) {
+	for k := 0; k <= len(cur); k++ {
+		rest := cur[k:]
+		if len(rest) > len(old) {
+			continue
+		}
+		match := true
+		for i := range rest {
+			if rest[i] != old[i] {
+				match = false
+				break
+			}
+		}
+		if match {
+			// a snake moves one cell per tick, anything else was rewritten
+			return cur[:k], len(old) - len(rest), k <= 1
+		}
+	}
+	return nil, 0, false
+}
+
+func containsPos(list []Vector2, pos Vector2) bool {
+	for _, v := range list {
+		if v == pos {
+			return true
+		}
+	}
+	return false
+}
+
+// Decide if the client needs a full snapshot for this tick instead of a delta
+func (c *clientSync) needsKeyframe(tick uint64) bool {
+	return !c.Delta || c.Resync || c.LastTick+1 != tick || tick%KEYFRAME_INTERVAL == 0
+}
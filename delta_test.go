@@ -0,0 +1,95 @@
+package main
+
+import (
+	"slices"
+	"testing"
+
+	"cacing/protocol"
+)
+
+func TestDiffBody(t *testing.T) {
+	a, b, c, d := Vector2{1, 1}, Vector2{2, 1}, Vector2{3, 1}, Vector2{0, 1}
+	for _, tc := range []struct {
+		name     string
+		old, cur []Vector2
+		heads    []Vector2
+		tail     int
+		ok       bool
+	}{
+		{"unchanged", []Vector2{a, b, c}, []Vector2{a, b, c}, nil, 0, true},
+		{"move", []Vector2{a, b, c}, []Vector2{d, a, b}, []Vector2{d}, 1, true},
+		{"grow", []Vector2{a, b, c}, []Vector2{d, a, b, c}, []Vector2{d}, 0, true},
+		{"shrink", []Vector2{a, b, c}, []Vector2{a}, nil, 2, true},
+		{"one cell move", []Vector2{a}, []Vector2{b}, []Vector2{b}, 1, true},
+		{"respawn", []Vector2{a, b, c}, []Vector2{d}, []Vector2{d}, 3, true},
+		{"new snake", nil, []Vector2{a}, []Vector2{a}, 0, true},
+		{"rewritten", []Vector2{a, b, c}, []Vector2{c, b, a}, nil, 0, false},
+		{"two heads", []Vector2{a, b}, []Vector2{c, d, a}, nil, 0, false},
+	} {
+		heads, tail, ok := diffBody(tc.old, tc.cur)
+		if ok != tc.ok || (ok && (!slices.Equal(heads, tc.heads) || tail != tc.tail)) {
+			t.Errorf("%s: got %v %d %v, want %v %d %v", tc.name, heads, tail, ok, tc.heads, tc.tail, tc.ok)
+		}
+	}
+}
+
+func TestDiffFrames(t *testing.T) {
+	room := &Room{Tick: 1, Foods: []Food{{Position: Vector2{5, 5}}}}
+	mover := &Player{ID: 1, Room: room, Snake: &Snake{Body: []Vector2{{1, 1}, {2, 1}}, BodyLen: 2}}
+	warped := &Player{ID: 2, Room: room, Snake: &Snake{Body: []Vector2{{1, 5}, {2, 5}, {3, 5}}, BodyLen: 3}}
+	leaver := &Player{ID: 3, Room: room, Snake: &Snake{Body: []Vector2{{8, 8}}, BodyLen: 1}}
+	room.Players = []*Player{mover, warped, leaver}
+	prev := captureFrame(room)
+
+	room.Tick = 2
+	mover.Snake.Body = []Vector2{{0, 1}, {1, 1}, {2, 1}}
+	mover.Snake.BodyLen = 3
+	warped.Snake.Body = []Vector2{{3, 5}, {2, 5}, {1, 5}}
+	joiner := &Player{ID: 4, Room: room, Snake: &Snake{Body: []Vector2{{9, 9}}, BodyLen: 1}}
+	room.Players = []*Player{mover, warped, joiner}
+	room.Foods = []Food{{Position: Vector2{6, 6}}}
+	d := diffFrames(prev, captureFrame(room), room)
+
+	if d.Tick != 2 || d.Base != 1 {
+		t.Errorf("ticks: %d from %d", d.Tick, d.Base)
+	}
+	if len(d.Snakes) != 1 || d.Snakes[0].ID != 1 || len(d.Snakes[0].Head) != 1 || d.Snakes[0].Tail != 0 ||
+		d.Snakes[0].BodyLen == nil || *d.Snakes[0].BodyLen != 3 {
+		t.Errorf("snakes: %+v", d.Snakes)
+	}
+	var added []int
+	for _, v := range d.Added {
+		added = append(added, v.ID)
+	}
+	slices.Sort(added)
+	slices.Sort(d.Removed)
+	if !slices.Equal(added, []int{2, 4}) || !slices.Equal(d.Removed, []int{2, 3}) {
+		t.Errorf("added %v, removed %v", added, d.Removed)
+	}
+	want := func(foods []protocol.Food, x, y int) bool {
+		return len(foods) == 1 && foods[0].Pos.X == x && foods[0].Pos.Y == y
+	}
+	if !want(d.FoodsAdded, 6, 6) || !want(d.FoodsRemoved, 5, 5) {
+		t.Errorf("foods added %v, removed %v", d.FoodsAdded, d.FoodsRemoved)
+	}
+}
+
+func TestNeedsKeyframe(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		sync clientSync
+		tick uint64
+		want bool
+	}{
+		{"in sync", clientSync{Delta: true, LastTick: 4}, 5, false},
+		{"no deltas", clientSync{LastTick: 4}, 5, true},
+		{"resync", clientSync{Delta: true, LastTick: 4, Resync: true}, 5, true},
+		{"gap", clientSync{Delta: true, LastTick: 3}, 5, true},
+		{"first frame", clientSync{Delta: true}, 5, true},
+		{"interval", clientSync{Delta: true, LastTick: KEYFRAME_INTERVAL - 1}, KEYFRAME_INTERVAL, true},
+	} {
+		if got := tc.sync.needsKeyframe(tc.tick); got != tc.want {
+			t.Errorf("%s: got %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
@@ -1,7 +1,7 @@
 import { useState, useEffect, useRef } from "react";
 import { useInputUserName } from "./hooks/useUsername";
 import { WebSocketProvider, useWebSocketContext } from "./context/WebSocketContext";
-import NameInput from "./components/inputUsername";
+import NameInput, { serverUrl } from "./components/inputUsername";
 import MainMenu from "./components/MainMenu";
 import FindRoom from "./components/findRoomById";
 import SnakeCanvas from "./pages/games";
@@ -63,13 +63,12 @@ function AppContent() {
 
             // ✅ Only attempt if current userName matches stored playerName
             if (storedPlayerData && serverIp && serverPort && storedPlayerName && storedPlayerName === userName) {
-                console.log("Attempting auto-reconnect with stored data:", storedPlayerData);
+                console.log("Attempting auto-reconnect as player", storedPlayerData.id);
                 hasAttemptedReconnect.current = true;
                 setIsReconnecting(true);
 
                 try {
-                    const wsUrl = `ws://${serverIp}:${serverPort}/ws`;
-                        const connected = await connect(wsUrl);
+                    const connected = await connect(serverUrl(serverIp, serverPort));
 
                     if (connected) {
                         await new Promise(resolve => setTimeout(resolve, 200));
@@ -78,7 +77,7 @@ function AppContent() {
                             type: "reconnect",
                             data: {
                                 id: storedPlayerData.id,
-                                unique_id: storedPlayerData.unique_id,
+                                token: storedPlayerData.token,
                             }
                         });
 
@@ -220,11 +219,11 @@ function AppContent() {
         ) : (
         <MainMenu
         onQuit={handleQuit}
-        onCreateRoom={() => {
+        onCreateRoom={(req) => {
             // Send create room message to server
             sendMessage({
                 type: "create",
-                data: {}
+                data: req
             });
             // Room will be auto-joined when createdRoom state updates
         }}
@@ -1,8 +1,12 @@
 // All Interfaces Data Used in Frontend
 
+// Wire types generated from the Go protocol package (go generate ./protocol)
+export * from './protocol';
+import type { CreateRequest, QueuePosition, RoomCountdown, RoomListing, RoomStatus } from './protocol';
+
 export interface MainMenuProps {
   onQuit: () => void;
-  onCreateRoom: () => void;
+  onCreateRoom: (req: CreateRequest) => void;
   onFindRoom: () => void;
 }
 
@@ -51,7 +55,7 @@ export interface GameResultProps {
 export interface PlayerData {
     id: number;
     name: string;
-    unique_id: string;
+    token: string;
 }
 
 export interface WebSocketContextType {
@@ -72,4 +76,8 @@ export interface WebSocketContextType {
     clearRoomState: () => void;
     deathData: any | null;
     clearDeathData: () => void;
+    publicRooms: RoomListing[];
+    queuePosition: QueuePosition | null;
+    roomStatus: RoomStatus | null;
+    countdown: RoomCountdown | null;
 }
@@ -0,0 +1,256 @@
+// Code generated by cmd/protogen from the protocol package. DO NOT EDIT.
+
+export const PROTOCOL_VERSION = 1;
+export const PROTOCOL_MIN_VERSION = 1;
+
+export type ErrorCode = "BAD_PAYLOAD" | "UNKNOWN_TYPE" | "UNSUPPORTED_VERSION" | "NOT_CONNECTED" | "ALREADY_CONNECTED" | "RECONNECT_FAILED" | "ALREADY_IN_ROOM" | "NOT_IN_ROOM" | "ROOM_NOT_FOUND" | "WRONG_PASSWORD" | "ROOM_FULL" | "ROOM_LOCKED" | "KICKED" | "NOT_HOST" | "WRONG_STATE" | "RATE_LIMITED" | "SERVER_FULL" | "SHUTTING_DOWN" | "INTERNAL";
+
+export type EventType = "broadcast_room" | "broadcast_delta" | "broadcast_snake_ded" | "server_shutdown" | "server_message" | "room_settings" | "room_closed" | "queue_position" | "room_state" | "room_kicked" | "room_countdown";
+
+export type PlayerFlag = "disconnected" | "host" | "ready";
+
+export type RequestType = "connect" | "reconnect" | "create" | "join" | "disconnect" | "input" | "resync" | "list_rooms" | "ready" | "start" | "pause" | "resume" | "kick" | "lock" | "settings" | "transfer_host";
+
+export type ResponseType = "player" | "room" | "snake" | "rooms" | "queued" | "ok" | "fail";
+
+export type RoomMap = "open";
+
+export type RoomMode = "classic";
+
+export type RoomState = "lobby" | "starting" | "playing" | "paused";
+
+export interface Envelope {
+    type: string;
+    request_id?: string;
+    data?: unknown;
+}
+
+export interface Response {
+    response: string;
+    request_id?: string;
+    type: string;
+    data: unknown;
+}
+
+export interface Event {
+    type: string;
+    data: unknown;
+}
+
+export interface ConnectRequest {
+    name: string;
+    version?: number;
+    delta?: boolean;
+}
+
+export interface ReconnectRequest {
+    id: number;
+    token: string;
+}
+
+export interface CreateRequest {
+    name?: string;
+    public?: boolean;
+    mode?: string;
+    map?: string;
+    password?: string;
+    capacity?: number;
+    queue?: boolean;
+}
+
+export interface JoinRequest {
+    room: string;
+    password?: string;
+}
+
+export interface ReadyRequest {
+    ready: boolean;
+}
+
+export interface KickRequest {
+    player: number;
+}
+
+export interface LockRequest {
+    locked: boolean;
+}
+
+export interface TransferHostRequest {
+    player: number;
+}
+
+export interface SettingsRequest {
+    arena_width?: number;
+    arena_height?: number;
+    tick_ms?: number;
+    capacity?: number;
+    ready_quorum?: number;
+}
+
+export interface InputRequest {
+    dir: number;
+    tick?: number;
+}
+
+export interface PlayerInfo {
+    id: number;
+    name: string;
+    token: string;
+    token_expires: number;
+    protocol_version: number;
+    resume?: Resume;
+}
+
+export interface Resume {
+    room: string;
+    settings: RoomSettings;
+    snake: Snake | null;
+    snapshot: RoomSnapshot;
+    status: RoomStatus;
+}
+
+export interface RoomSettings {
+    arena_width: number;
+    arena_height: number;
+    tick_ms: number;
+    capacity: number;
+    ready_quorum: number;
+}
+
+export interface Vector2 {
+    x: number;
+    y: number;
+}
+
+export interface Food {
+    pos: Vector2;
+}
+
+export interface Snake {
+    body: Vector2[];
+    body_len: number;
+    dir: number;
+    color: string;
+    dead: boolean;
+}
+
+export interface PlayerView {
+    id: number;
+    name: string;
+    snake: Snake | null;
+    team?: string;
+    score: number;
+    flags?: string[];
+    ping: number;
+}
+
+export interface Room {
+    id: string;
+    name: string;
+    public: boolean;
+    password: boolean;
+    queue: boolean;
+    status: RoomStatus;
+    mode: string;
+    map: string;
+    settings: RoomSettings;
+    players: PlayerView[];
+    foods: Food[];
+}
+
+export interface RoomListing {
+    id: string;
+    name: string;
+    mode: string;
+    map: string;
+    password: boolean;
+    players: number;
+    capacity: number;
+    queued: number;
+    status: string;
+}
+
+export interface RoomList {
+    rooms: RoomListing[];
+}
+
+export interface RoomSnapshot {
+    tick: number;
+    snakes: PlayerView[];
+    foods: Food[];
+}
+
+export interface ServerShutdown {
+    reason: string;
+    deadline: number;
+    seconds_left: number;
+}
+
+export interface ServerMessage {
+    message: string;
+}
+
+export interface RoomStatus {
+    room: string;
+    state: string;
+    host: number;
+    locked: boolean;
+}
+
+export interface RoomCountdown {
+    room: string;
+    seconds_left: number;
+    starts_at: number;
+}
+
+export interface QueuePosition {
+    room: string;
+    position: number;
+    size: number;
+}
+
+export interface RoomClosed {
+    room: string;
+    reason: string;
+}
+
+export interface ServerInfo {
+    version: string;
+    commit: string;
+    protocol_version: number;
+    min_protocol_version: number;
+    uptime_seconds: number;
+    tick_ms: number;
+    rooms: number;
+    players: number;
+    players_connected: number;
+    draining: boolean;
+}
+
+export interface SnakeDelta {
+    id: number;
+    head?: Vector2[];
+    tail?: number;
+    body_len?: number;
+    dir?: number;
+    dead?: boolean;
+    ping?: number;
+    flags?: string[];
+}
+
+export interface RoomDelta {
+    tick: number;
+    base: number;
+    snakes: SnakeDelta[];
+    added?: PlayerView[];
+    removed?: number[];
+    foods_added?: Food[];
+    foods_removed?: Food[];
+}
+
+export interface Fail {
+    code: string;
+    message: string;
+    context: string;
+    details?: Record<string, unknown>;
+}
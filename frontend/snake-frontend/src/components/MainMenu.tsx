@@ -1,3 +1,4 @@
+import { useState } from "react";
 import { useInputUserName } from "../hooks/useUsername";
 import type { MainMenuProps } from "../api/interface";
 
@@ -5,6 +6,9 @@ import type { MainMenuProps } from "../api/interface";
 export default function MainMenu(props: MainMenuProps) {
   const { onQuit, onCreateRoom, onFindRoom } = props;
   const { userName } = useInputUserName();
+  // New rooms are private like on the server, listed only when asked for
+  const [isPublic, setIsPublic] = useState(false);
+  const [password, setPassword] = useState("");
 
   return (
     <div className="p-8 bg-gray-800 rounded-lg shadow-lg flex flex-col items-center w-80">
@@ -15,9 +19,27 @@ export default function MainMenu(props: MainMenuProps) {
         Snake Game
       </h1>
 
+      {/* Create Room options */}
+      <label className="w-full mb-2 flex items-center gap-2 text-gray-300 text-sm">
+        <input
+          type="checkbox"
+          checked={isPublic}
+          onChange={(e) => setIsPublic(e.target.checked)}
+        />
+        List in public rooms
+      </label>
+      <input
+        type="password"
+        placeholder="Room password (optional)"
+        value={password}
+        onChange={(e) => setPassword(e.target.value)}
+        maxLength={64}
+        className="w-full mb-4 px-3 py-2 bg-gray-700 text-white rounded-md border border-gray-600 focus:border-blue-500 focus:outline-none"
+      />
+
       {/* Create Room */}
       <button
-        onClick={onCreateRoom}
+        onClick={() => onCreateRoom({ public: isPublic, password: password || undefined })}
         className="w-full px-4 py-2 bg-green-500 text-white rounded-lg hover:bg-green-600 transition duration-200 ease-in-out active:scale-95 font-bold"
       >
         Create Room
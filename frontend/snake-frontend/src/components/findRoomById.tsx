@@ -8,11 +8,26 @@ export default function FindRoom({ onBack, onJoinGame }: FindRoomProps) {
   const [roomId, setRoomId] = useState(["", "", "", "", ""]);
   // Refs for input elements
   const inputRefs = useRef<(HTMLInputElement | null)[]>([]);
+  // Room password, only needed for protected rooms
+  const [password, setPassword] = useState("");
   // Set Joining Room Status
   const [isJoining, setIsJoining] = useState(false);
   // Get WebSocket Context
-  const { joinError, clearJoinError, sendMessage, playerSnake } =
-    useWebSocketContext();
+  const {
+    joinError,
+    clearJoinError,
+    sendMessage,
+    playerSnake,
+    publicRooms,
+    queuePosition,
+  } = useWebSocketContext();
+
+  // Keep the public room list fresh while this screen is open
+  useEffect(() => {
+    sendMessage({ type: "list_rooms" });
+    const timer = setInterval(() => sendMessage({ type: "list_rooms" }), 3000);
+    return () => clearInterval(timer);
+  }, [sendMessage]);
 
   // Another useEffect to Check Current User Status
   useEffect(() => {
@@ -105,13 +120,17 @@ export default function FindRoom({ onBack, onJoinGame }: FindRoomProps) {
   // Handle Join Room (Placeholder for actual API call)
   const handleJoinRoom = () => {
     // To Consistence with server, convert to uppercase
-    const fullRoomId = roomId.join("").toUpperCase();
+    joinRoom(roomId.join("").toUpperCase());
+  };
+
+  const joinRoom = (fullRoomId: string) => {
     if (fullRoomId.length === 5) {
+      setRoomId(fullRoomId.split(""));
       setIsJoining(true);
       clearJoinError();
 
       // Send join room message via WebSocket
-      sendMessage({ type: "join", data: { room: fullRoomId } });
+      sendMessage({ type: "join", data: { room: fullRoomId, password } });
     }
   };
 
@@ -134,6 +153,13 @@ export default function FindRoom({ onBack, onJoinGame }: FindRoomProps) {
         </div>
       )}
 
+      {queuePosition && isJoining && (
+        <div className="mb-4 p-3 bg-yellow-600 text-white rounded-lg text-sm text-center w-full">
+          Room is full, you are #{queuePosition.position} of{" "}
+          {queuePosition.size} in line.
+        </div>
+      )}
+
       {/* Input Field Room ID */}
       <div className="flex justify-center gap-2 mb-6">
         {roomId.map((digit, index) => (
@@ -153,6 +179,15 @@ export default function FindRoom({ onBack, onJoinGame }: FindRoomProps) {
         ))}
       </div>
 
+      <input
+        type="password"
+        placeholder="Password (if any)"
+        value={password}
+        onChange={(e) => setPassword(e.target.value)}
+        disabled={isJoining}
+        className="w-full mb-4 px-3 py-2 bg-gray-700 text-white rounded-md border border-gray-600 focus:border-blue-500 focus:outline-none"
+      />
+
       {/* Join Room Button if the 5 digits are filled */}
       <button
         onClick={handleJoinRoom}
@@ -169,6 +204,32 @@ export default function FindRoom({ onBack, onJoinGame }: FindRoomProps) {
         )}
       </button>
 
+      {/* Public rooms, click one to join it */}
+      {publicRooms.length > 0 && (
+        <div className="w-full mb-4">
+          <h2 className="text-gray-300 text-sm mb-2">Public rooms</h2>
+          <ul className="max-h-48 overflow-y-auto flex flex-col gap-1">
+            {publicRooms.map((room) => (
+              <li key={room.id}>
+                <button
+                  onClick={() => joinRoom(room.id)}
+                  disabled={isJoining}
+                  className="w-full px-3 py-2 bg-gray-700 hover:bg-gray-600 disabled:cursor-not-allowed text-white rounded-md text-sm flex justify-between"
+                >
+                  <span className="truncate">
+                    {room.password ? "🔒 " : ""}
+                    {room.name}
+                  </span>
+                  <span className="text-gray-400">
+                    {room.capacity ? `${room.players}/${room.capacity}` : room.players}
+                  </span>
+                </button>
+              </li>
+            ))}
+          </ul>
+        </div>
+      )}
+
       {/* Same as CreateRoom, handle Back with removing Finding Room status */}
       <button
         onClick={handleBack}
@@ -1,18 +1,25 @@
 import { useState, useEffect } from "react";
 import type { UserData } from "../api/interface";
+import { PROTOCOL_VERSION } from "../api/protocol";
 import { useWebSocketContext } from "../context/WebSocketContext";
 
+// Socket URL of the game server, a page served over https may only open wss://
+export function serverUrl(ip: string, port: string) {
+  const scheme = window.location.protocol === "https:" ? "wss" : "ws";
+  return `${scheme}://${ip}:${port}/ws`;
+}
+
 export default function NameInput(props: UserData) {
   const { userName, setUserName, onConfirm } = props;
   const { sendMessage, isConnected, connect, playerData } = useWebSocketContext();
 
-  // Server configuration state
+  // Server configuration state, a production build is served by the game server itself
   const [serverIp, setServerIp] = useState(() => {
-    return localStorage.getItem("serverIp") || "localhost";
+    return localStorage.getItem("serverIp") || (import.meta.env.DEV ? "localhost" : window.location.hostname);
   });
   // Port state
   const [serverPort, setServerPort] = useState(() => {
-    return localStorage.getItem("serverPort") || "8080";
+    return localStorage.getItem("serverPort") || (import.meta.env.DEV ? "8080" : window.location.port || (window.location.protocol === "https:" ? "443" : "80"));
   });
   // Connecting state
   const [isConnecting, setIsConnecting] = useState(false);
@@ -41,7 +48,7 @@ export default function NameInput(props: UserData) {
     setError(null);
 
     // Build WebSocket URL
-    const wsUrl = `ws://${serverIp}:${serverPort}/ws`;
+    const wsUrl = serverUrl(serverIp, serverPort);
 
     try {
       // Connect to WebSocket (wait for connection to establish)
@@ -59,7 +66,7 @@ export default function NameInput(props: UserData) {
       await new Promise(resolve => setTimeout(resolve, 200));
 
       // Send connect message with username
-      sendMessage({ type: "connect", data: { name: userName } });
+      sendMessage({ type: "connect", data: { name: userName, version: PROTOCOL_VERSION } });
 
       // Wait for server to respond with player data
       // The useEffect above will call onConfirm when playerData is received
@@ -166,7 +173,7 @@ export default function NameInput(props: UserData) {
       </button>
 
       <div className="mt-4 text-gray-400 text-xs text-center">
-        <p>Default: ws://localhost:8080/ws</p>
+        <p>Connects to {serverUrl(serverIp || "localhost", serverPort || "8080")}</p>
       </div>
     </div>
   );
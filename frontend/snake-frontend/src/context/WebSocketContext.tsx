@@ -1,11 +1,20 @@
 import { createContext, useContext, useRef, useState, useCallback } from 'react';
 import type { ReactNode } from 'react';
 import type { PlayerData, WebSocketContextType } from '../api/interface';
+import type { QueuePosition, RoomCountdown, RoomListing, RoomStatus } from '../api/protocol';
 
 const WebSocketContext = createContext<WebSocketContextType | undefined>(undefined);
 
+// Copy of a message that is safe to log, the session token stays out of the console
+function redactToken(msg: any) {
+    if (msg?.data?.token === undefined) return msg;
+    return { ...msg, data: { ...msg.data, token: "[redacted]" } };
+}
+
 export function WebSocketProvider({ children }: { children: ReactNode }) {
     const wsRef = useRef<WebSocket | null>(null);
+    // Last server tick seen, inputs are stamped with the tick they are meant for
+    const lastTickRef = useRef<number>(0);
     const [isConnected, setIsConnected] = useState(false);
     const [gameState, setGameState] = useState<any>(null);
     const [playerSnake, setPlayerSnake] = useState<any>(null);
@@ -14,6 +23,10 @@ export function WebSocketProvider({ children }: { children: ReactNode }) {
     const [createdRoom, setCreatedRoom] = useState<any | null>(null);
     const [joinError, setJoinError] = useState<string | null>(null);
     const [deathData, setDeathData] = useState<any | null>(null);
+    const [publicRooms, setPublicRooms] = useState<RoomListing[]>([]);
+    const [queuePosition, setQueuePosition] = useState<QueuePosition | null>(null);
+    const [roomStatus, setRoomStatus] = useState<RoomStatus | null>(null);
+    const [countdown, setCountdown] = useState<RoomCountdown | null>(null);
 
     const clearReconnectFailed = useCallback(() => {
         setReconnectFailed(false);
@@ -25,6 +38,9 @@ export function WebSocketProvider({ children }: { children: ReactNode }) {
 
     const clearDeathData = useCallback(() => {
         setDeathData(null);
+        setQueuePosition(null);
+        setRoomStatus(null);
+        setCountdown(null);
     }, []);
 
     // ✅ Clear all room-related state
@@ -34,6 +50,7 @@ export function WebSocketProvider({ children }: { children: ReactNode }) {
         setPlayerSnake(null);
         setGameState(null);
         setDeathData(null);
+        setCountdown(null);
     }, []);
 
     const connect = useCallback((url: string): Promise<boolean> => {
@@ -62,27 +79,37 @@ export function WebSocketProvider({ children }: { children: ReactNode }) {
 
                 ws.onmessage = (event) => {
                     const msg = JSON.parse(event.data);
-                    console.log('Received message:', msg);
+                    console.log('Received message:', redactToken(msg));
 
                     switch (msg.type) {
                         case "player":
                             const player: PlayerData = {
                             id: msg.data.id,
                             name: msg.data.name,
-                            unique_id: msg.data.unique_id,
+                            token: msg.data.token,
                         };
                         setPlayerData(player);
 
                         localStorage.setItem("playerId", player.id.toString());
                         localStorage.setItem("playerName", player.name);
-                        localStorage.setItem("playerUniqueId", player.unique_id);
+                        localStorage.setItem("playerToken", player.token);
+
+                        // Reconnected while still in a room: restore snake and board
+                        if (msg.data.resume) {
+                            setPlayerSnake(msg.data.resume.snake);
+                            setGameState(msg.data.resume.snapshot);
+                            setRoomStatus(msg.data.resume.status);
+                            lastTickRef.current = msg.data.resume.snapshot.tick ?? 0;
+                            localStorage.setItem("currentRoomId", msg.data.resume.room);
+                        }
 
-                        console.log("Player data saved:", player);
+                        console.log("Player data saved:", { id: player.id, name: player.name });
                         break;
 
                         case "room":
                             console.log("Room created:", msg.data);
                         setCreatedRoom(msg.data);
+                        setRoomStatus(msg.data.status);
                         if (msg.data.id) {
                             localStorage.setItem("currentRoomId", msg.data.id);
                         }
@@ -92,9 +119,20 @@ export function WebSocketProvider({ children }: { children: ReactNode }) {
                             console.log("Snake data:", msg.data);
                         setPlayerSnake(msg.data);
                         setJoinError(null);
+                        setQueuePosition(null);
+                        break;
+
+                        case "queued":
+                        case "queue_position":
+                            setQueuePosition(msg.data);
+                        break;
+
+                        case "rooms":
+                            setPublicRooms(msg.data.rooms ?? []);
                         break;
 
                         case "broadcast_room":
+                            lastTickRef.current = msg.data.tick ?? 0;
                             setGameState(msg.data);
                         break;
 
@@ -105,6 +143,37 @@ export function WebSocketProvider({ children }: { children: ReactNode }) {
                         localStorage.removeItem("currentRoomId");
                         break;
 
+                        case "server_message":
+                            alert(msg.data.message);
+                        break;
+
+                        case "room_state":
+                            setRoomStatus(msg.data);
+                        if (msg.data.state !== "starting") {
+                            setCountdown(null);
+                        }
+                        break;
+
+                        case "room_countdown":
+                            setCountdown(msg.data);
+                        break;
+
+                        case "room_kicked":
+                        case "room_closed":
+                            console.warn("Room closed:", msg.data.reason);
+                        clearRoomState();
+                        localStorage.removeItem("currentRoomId");
+                        alert(msg.data.reason);
+                        break;
+
+                        case "room_settings":
+                            console.log("Room settings changed:", msg.data);
+                        break;
+
+                        case "server_shutdown":
+                            console.warn(`${msg.data.reason} Closing in ${msg.data.seconds_left}s`);
+                        break;
+
                         case "ok":
                             console.log("Operation successful:", msg.data);
                         if (msg.response === "disconnect") {
@@ -166,15 +235,15 @@ export function WebSocketProvider({ children }: { children: ReactNode }) {
     const sendMessage = useCallback((message: any) => {
         if (wsRef.current?.readyState === WebSocket.OPEN) {
             wsRef.current.send(JSON.stringify(message));
-            console.log('Sent message:', message);
+            console.log('Sent message:', redactToken(message));
         } else {
-            console.warn("WebSocket not open, message not sent:", message);
+            console.warn("WebSocket not open, message not sent:", redactToken(message));
         }
     }, []);
 
     const sendMove = useCallback((direction: number) => {
         if (wsRef.current?.readyState === WebSocket.OPEN) {
-            wsRef.current.send(JSON.stringify({ type: "input", data: { dir: direction } }));
+            wsRef.current.send(JSON.stringify({ type: "input", data: { dir: direction, tick: lastTickRef.current + 1 } }));
         }
     }, []);
 
@@ -197,6 +266,10 @@ export function WebSocketProvider({ children }: { children: ReactNode }) {
             clearRoomState,
             deathData,
             clearDeathData,
+            publicRooms,
+            queuePosition,
+            roomStatus,
+            countdown,
         }}>
         {children}
         </WebSocketContext.Provider>
@@ -14,11 +14,11 @@ export function useInputUserName() {
     // Check if player data exists in localStorage (set by WebSocketContext)
     const playerId = localStorage.getItem("playerId");
     const playerName = localStorage.getItem("playerName");
-    const playerUniqueId = localStorage.getItem("playerUniqueId");
+    const playerToken = localStorage.getItem("playerToken");
 
-    if (playerId && playerName && playerUniqueId) {
+    if (playerId && playerName && playerToken) {
       setIsFirstLogin(false);
-      console.log("User session validated:", { playerId, playerName, playerUniqueId });
+      console.log("User session validated:", { playerId, playerName });
     }
   };
 
@@ -26,16 +26,16 @@ export function useInputUserName() {
   const userSession = () => {
     const playerId = localStorage.getItem("playerId");
     const playerName = localStorage.getItem("playerName");
-    const playerUniqueId = localStorage.getItem("playerUniqueId");
+    const playerToken = localStorage.getItem("playerToken");
 
-    return Boolean(playerId && playerName && playerUniqueId);
+    return Boolean(playerId && playerName && playerToken);
   };
 
   // Handle Delete User Name (Logout)
   const deleteUserName = () => {
     localStorage.removeItem("playerId");
     localStorage.removeItem("playerName");
-    localStorage.removeItem("playerUniqueId");
+    localStorage.removeItem("playerToken");
     localStorage.removeItem("serverIp");
     localStorage.removeItem("serverPort");
     setUserName("");
@@ -45,12 +45,12 @@ export function useInputUserName() {
   // Get stored player data for reconnection
   const getPlayerData = () => {
     const playerId = localStorage.getItem("playerId");
-    const playerUniqueId = localStorage.getItem("playerUniqueId");
+    const playerToken = localStorage.getItem("playerToken");
 
-    if (playerId && playerUniqueId) {
+    if (playerId && playerToken) {
       return {
         id: parseInt(playerId),
-        unique_id: playerUniqueId,
+        token: playerToken,
       };
     }
     return null;
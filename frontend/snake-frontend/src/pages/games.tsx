@@ -5,7 +5,22 @@ import type { SnakeCanvasProps } from "../api/interface";
 
 export default function SnakeCanvas({ roomId, onBack }: SnakeCanvasProps) {
     const canvasRef = useRef<HTMLCanvasElement>(null);
-    const { isConnected, gameState, playerData, sendMove, deathData, clearDeathData } = useWebSocketContext();
+    const { isConnected, gameState, playerData, sendMove, sendMessage, deathData, clearDeathData, roomStatus, countdown } = useWebSocketContext();
+    const isHost = roomStatus != null && roomStatus.host === playerData?.id;
+    const [ready, setReady] = useState(false);
+    const inLobby = roomStatus?.state === "lobby" || roomStatus?.state === "starting";
+
+    // the server forgets readiness once the match starts
+    useEffect(() => {
+        if (!inLobby) {
+            setReady(false);
+        }
+    }, [inLobby]);
+
+    const toggleReady = () => {
+        sendMessage({ type: "ready", data: { ready: !ready } });
+        setReady(!ready);
+    };
 
     // Store previous game state for interpolation
     const prevGameStateRef = useRef<any>(null);
@@ -205,6 +220,22 @@ export default function SnakeCanvas({ roomId, onBack }: SnakeCanvasProps) {
         return snake.body_len ?? snake.bodyLen ?? snake.BodyLen ?? snake.body?.length ?? snake.Body?.length ?? 0;
     })();
 
+    // Scoreboard with every player's score and ping
+    const scoreboard = (() => {
+        if (!gameState) return [];
+        const players = gameState.snakes || gameState.Snakes || gameState.players || gameState.Players;
+        if (!players || !Array.isArray(players)) return [];
+
+        return players
+            .map((p: any) => ({
+                id: p.id,
+                name: p.name,
+                score: p.score ?? p.snake?.body_len ?? 0,
+                ping: p.ping ?? 0,
+            }))
+            .sort((a: any, b: any) => b.score - a.score);
+    })();
+
     // Get player count
     const playerCount = (() => {
         if (!gameState) return 0;
@@ -276,6 +307,77 @@ export default function SnakeCanvas({ roomId, onBack }: SnakeCanvasProps) {
                 <p className="text-xs">Arrow Keys / WASD to move</p>
             </div>
 
+            {/* Scoreboard */}
+            <div className="absolute top-24 right-4 p-3 bg-gray-800 rounded-lg border border-gray-700 shadow-lg text-xs min-w-40">
+                <p className="text-gray-400 font-semibold mb-1">Scoreboard</p>
+                {scoreboard.map((p: any) => (
+                    <div key={p.id} className={`flex justify-between gap-4 ${p.id === playerData?.id ? "text-green-400" : "text-white"}`}>
+                        <span className="truncate">{p.name}</span>
+                        <span>
+                            {p.score} · {p.ping} ms
+                            {isHost && p.id !== playerData?.id && (
+                                <button
+                                    onClick={() => sendMessage({ type: "kick", data: { player: p.id } })}
+                                    className="ml-2 text-red-400 hover:text-red-300"
+                                    title="Kick"
+                                >
+                                    ✕
+                                </button>
+                            )}
+                        </span>
+                    </div>
+                ))}
+            </div>
+
+            {/* Countdown to the match */}
+            {roomStatus?.state === "starting" && countdown && (
+                <div className="absolute inset-0 flex items-center justify-center pointer-events-none">
+                    <span className="text-white text-8xl font-bold drop-shadow-lg">{countdown.seconds_left}</span>
+                </div>
+            )}
+
+            {/* Room state, players ready up, the host starts, pauses and locks the room */}
+            {roomStatus && (
+                <div className="absolute bottom-8 left-1/2 transform -translate-x-1/2 flex items-center gap-2">
+                    {roomStatus.state !== "playing" && (
+                        <span className="text-yellow-400 text-sm font-semibold">
+                            {roomStatus.state === "lobby" ? "Waiting for players to get ready" : roomStatus.state === "starting" ? "Starting" : "Paused"}
+                        </span>
+                    )}
+                    {inLobby && (
+                        <button
+                            onClick={toggleReady}
+                            className={`px-4 py-2 text-white rounded-lg font-bold ${ready ? "bg-gray-700 hover:bg-gray-600" : "bg-blue-600 hover:bg-blue-700"}`}
+                        >
+                            {ready ? "Not ready" : "Ready"}
+                        </button>
+                    )}
+                    {isHost && roomStatus.state === "lobby" && (
+                        <button onClick={() => sendMessage({ type: "start" })} className="px-4 py-2 bg-green-600 hover:bg-green-700 text-white rounded-lg font-bold">
+                            Start
+                        </button>
+                    )}
+                    {isHost && roomStatus.state === "playing" && (
+                        <button onClick={() => sendMessage({ type: "pause" })} className="px-4 py-2 bg-yellow-600 hover:bg-yellow-700 text-white rounded-lg font-bold">
+                            Pause
+                        </button>
+                    )}
+                    {isHost && roomStatus.state === "paused" && (
+                        <button onClick={() => sendMessage({ type: "resume" })} className="px-4 py-2 bg-green-600 hover:bg-green-700 text-white rounded-lg font-bold">
+                            Resume
+                        </button>
+                    )}
+                    {isHost && (
+                        <button
+                            onClick={() => sendMessage({ type: "lock", data: { locked: !roomStatus.locked } })}
+                            className="px-4 py-2 bg-gray-700 hover:bg-gray-600 text-white rounded-lg"
+                        >
+                            {roomStatus.locked ? "Unlock" : "Lock"}
+                        </button>
+                    )}
+                </div>
+            )}
+
             {/* Player Score */}
             <div className="absolute bottom-8 right-8 p-3 bg-gray-800 rounded-lg border border-gray-700 shadow-lg">
                 <p className="text-gray-400 text-xs mb-1">Your Score</p>
@@ -11,4 +11,9 @@ export default defineConfig({
     }),
     tailwindcss(),
   ],
+  // the Go server embeds this build, see client.go
+  build: {
+    outDir: '../../client/dist',
+    emptyOutDir: true,
+  },
 })
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"cacing/protocol"
+)
+
+// Running server for a test, stopped when the test ends
+func newTestServer(t *testing.T) (*Server, string) {
+	t.Helper()
+	s := newServer(defaultConfig())
+	url := serveTest(t, s)
+	// a room left ticking would slow down the tests that come after
+	t.Cleanup(func() { s.stop(context.Background()) })
+	return s, url
+}
+
+// Start s behind a test listener and return its websocket URL, stopping s
+// is up to the caller
+func serveTest(t *testing.T, s *Server) string {
+	t.Helper()
+	hs := httptest.NewServer(http.HandlerFunc(s.handleConnection))
+	t.Cleanup(hs.Close)
+	s.start()
+	return "ws" + strings.TrimPrefix(hs.URL, "http") + "/ws"
+}
+
+// Client that connects, keeps every frame it reads and remembers its token
+type testClient struct {
+	conn   *websocket.Conn
+	id     int
+	token  string
+	frames [][]byte
+}
+
+// Socket without a player yet, for tests that connect or reconnect themselves
+func dialSocket(t *testing.T, url, sub string) *testClient {
+	t.Helper()
+	d := websocket.Dialer{}
+	if sub != "" {
+		d.Subprotocols = []string{sub}
+	}
+	conn, _, err := d.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return &testClient{conn: conn}
+}
+
+func dialClient(t *testing.T, url, sub string, connect protocol.ConnectRequest) *testClient {
+	t.Helper()
+	c := dialSocket(t, url, sub)
+	c.send(t, protocol.TypeConnect, connect)
+	var resp struct {
+		Type string              `json:"type"`
+		Data protocol.PlayerInfo `json:"data"`
+	}
+	if err := json.Unmarshal(c.read(t), &resp); err != nil || resp.Type != protocol.TypePlayer {
+		t.Fatalf("connect failed: %v %s", err, c.frames[len(c.frames)-1])
+	}
+	if len(resp.Data.Token) < 32 {
+		t.Fatalf("session token too short: %q", resp.Data.Token)
+	}
+	c.id = resp.Data.ID
+	c.token = resp.Data.Token
+	// the player response is the one frame allowed to carry the token
+	c.frames = nil
+	return c
+}
+
+func (c *testClient) send(t *testing.T, typ string, data any) {
+	t.Helper()
+	raw, _ := json.Marshal(data)
+	msg, _ := json.Marshal(protocol.Envelope{Type: typ, Data: raw})
+	if err := c.conn.WriteMessage(websocket.TextMessage, msg); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (c *testClient) read(t *testing.T) []byte {
+	t.Helper()
+	c.conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, b, err := c.conn.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.frames = append(c.frames, b)
+	return b
+}
+
+// Read until the reply to a request of type typ, skipping broadcasts
+func (c *testClient) reply(t *testing.T, typ string) protocol.Response {
+	t.Helper()
+	for {
+		var resp struct {
+			protocol.Response
+			Data json.RawMessage `json:"data"`
+		}
+		if json.Unmarshal(c.read(t), &resp) == nil && resp.Response.Response == typ {
+			resp.Response.Data = resp.Data
+			return resp.Response
+		}
+	}
+}
+
+// Read until an event of type typ, skipping everything else
+func (c *testClient) event(t *testing.T, typ string, data any) {
+	t.Helper()
+	for {
+		var event struct {
+			Type string          `json:"type"`
+			Data json.RawMessage `json:"data"`
+		}
+		if json.Unmarshal(c.read(t), &event) == nil && event.Type == typ {
+			if err := json.Unmarshal(event.Data, data); err != nil {
+				t.Fatal(err)
+			}
+			return
+		}
+	}
+}
+
+// Code of a fail reply, "" for any other reply
+func failCode(resp protocol.Response) string {
+	if resp.Type != protocol.TypeFail {
+		return ""
+	}
+	var fail protocol.Fail
+	json.Unmarshal(resp.Data.(json.RawMessage), &fail)
+	return fail.Code
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"cacing/protocol"
+)
+
+// Requests only the host of a room may send: start, pause, resume, kick,
+// lock, settings and transfer_host. Everyone in the room hears about the
+// outcome through room_state (or room_settings, room_countdown), the host gets ok.
+func (s *Server) handleHostRequest(conn *Conn, messageType int, incoming protocol.Envelope, p *Player) {
+	if p == nil {
+		sendFail(conn, messageType, incoming, protocol.ErrNotConnected, "Connect first to access "+incoming.Type+".")
+		return
+	}
+
+	// parse before taking the lock
+	var kick protocol.KickRequest
+	var lock protocol.LockRequest
+	var transfer protocol.TransferHostRequest
+	var settings protocol.SettingsRequest
+	var target any
+	switch incoming.Type {
+	case protocol.TypeKick:
+		target = &kick
+	case protocol.TypeLock:
+		target = &lock
+	case protocol.TypeTransferHost:
+		target = &transfer
+	case protocol.TypeSettings:
+		target = &settings
+	}
+	if target != nil {
+		if err := json.Unmarshal(incoming.Data, target); err != nil {
+			sendFail(conn, messageType, incoming, protocol.ErrBadPayload, "Failed to parse "+incoming.Type+" data")
+			return
+		}
+	}
+
+	s.Lock.Lock()
+	room := p.Room
+	if room == nil {
+		s.Lock.Unlock()
+		sendFail(conn, messageType, incoming, protocol.ErrNotInRoom, "Join a room first to access "+incoming.Type+".")
+		return
+	}
+	if room.Host != p {
+		s.Lock.Unlock()
+		sendFail(conn, messageType, incoming, protocol.ErrNotHost, "Only the host may "+incoming.Type+".")
+		return
+	}
+
+	var jobs []writeJob
+	code, reason := "", ""
+	// start, kick and settings have their own notices
+	notify := incoming.Type != protocol.TypeStart && incoming.Type != protocol.TypeKick && incoming.Type != protocol.TypeSettings
+	switch incoming.Type {
+	case protocol.TypeStart:
+		// same countdown as when everyone is ready, lobbyTick announces it
+		if room.State != protocol.RoomLobby {
+			code, reason = protocol.ErrWrongState, "The room is "+room.State+", not lobby."
+		} else {
+			room.beginCountdown(time.Now(), s.Countdown, true)
+		}
+	case protocol.TypePause:
+		code, reason = room.setState(protocol.RoomPlaying, protocol.RoomPaused)
+	case protocol.TypeResume:
+		code, reason = room.setState(protocol.RoomPaused, protocol.RoomPlaying)
+
+	case protocol.TypeLock:
+		room.Locked = lock.Locked
+
+	case protocol.TypeKick:
+		kicked := s.Players[kick.Player]
+		switch {
+		case kicked == p:
+			code, reason = protocol.ErrBadPayload, "The host can't kick itself, transfer the host first."
+		case kicked == nil || kicked.Room != room:
+			code, reason = protocol.ErrNotInRoom, "That player is not in the room."
+		default:
+			jobs = append(jobs, s.kickFromRoom(room, kicked)...)
+		}
+
+	case protocol.TypeTransferHost:
+		next := s.Players[transfer.Player]
+		switch {
+		case next == nil || next.Room != room:
+			code, reason = protocol.ErrNotInRoom, "That player is not in the room."
+		case next.Socket == nil:
+			code, reason = protocol.ErrBadPayload, "That player is disconnected."
+		default:
+			room.Host = next
+		}
+
+	case protocol.TypeSettings:
+		next := room.Settings.with(settings)
+		err := next.validate()
+		switch {
+		case room.State != protocol.RoomLobby:
+			code, reason = protocol.ErrWrongState, "Settings can only change in the lobby."
+		case err != nil:
+			code, reason = protocol.ErrBadPayload, err.Error()
+		default:
+			room.applySettings(next)
+			jobs = append(jobs, roomEvent(room, protocol.EventSettings, wireSettings(next))...)
+		}
+	}
+	if code == "" && notify {
+		jobs = append(jobs, roomEvent(room, protocol.EventState, roomStatus(room))...)
+	}
+	status := roomStatus(room)
+	s.Lock.Unlock()
+
+	if code != "" {
+		sendFail(conn, messageType, incoming, code, reason)
+		return
+	}
+	gameLog.Info("host request", "room", status.Room, "player", p.ID, "type", incoming.Type, "state", status.State, "host", status.Host, "locked", status.Locked)
+	sendResponse(conn, messageType, incoming, protocol.TypeOk, true)
+	for _, wj := range jobs {
+		_ = wj.conn.send(wj.kind, wj.msgType, wj.msg)
+	}
+}
+
+// Move the room from one state to another, the fail code and reason when it
+// isn't in the from state (call under lock)
+func (r *Room) setState(from, to string) (string, string) {
+	if r.State != from {
+		return protocol.ErrWrongState, "The room is " + r.State + ", not " + from + "."
+	}
+	r.State = to
+	// the first tick of the new state comes a whole interval later
+	r.NextTick = time.Now().Add(r.Settings.TickInterval)
+	return "", ""
+}
+
+// Send a player out of the room for good, returns the room_kicked notice (call under lock)
+func (s *Server) kickFromRoom(room *Room, p *Player) []writeJob {
+	removePlayer(room, p)
+	p.Room = nil
+	p.Snake = nil
+	p.Sync.Resync = true
+	if room.Kicked == nil {
+		room.Kicked = map[int]bool{}
+	}
+	room.Kicked[p.ID] = true
+	if p.Socket == nil {
+		return nil
+	}
+	msg, _ := json.Marshal(protocol.Event{Type: protocol.EventKicked, Data: protocol.RoomClosed{Room: room.UniqeID, Reason: "Kicked by the host."}})
+	return []writeJob{{conn: p.Socket, msgType: websocket.TextMessage, msg: msg, kind: protocol.EventKicked}}
+}
+
+// Hand the host role on when the host left the room or lost its socket, to
+// the longest present connected player. A disconnected host keeps the role
+// while nobody else is connected. Returns room_state on a change (call under lock)
+func (s *Server) migrateHost(room *Room) []writeJob {
+	host := room.Host
+	present := host != nil && host.Room == room
+	if present && host.Socket != nil {
+		return nil
+	}
+	var next *Player
+	for _, p := range room.Players {
+		if p != host && p.Socket != nil {
+			next = p
+			break
+		}
+	}
+	if next == nil && !present && len(room.Players) > 0 {
+		next = room.Players[0]
+	}
+	if next == nil {
+		if !present {
+			room.Host = nil
+		}
+		return nil
+	}
+	room.Host = next
+	gameLog.Info("host migrated", "room", room.UniqeID, "host", next.ID)
+	return roomEvent(room, protocol.EventState, roomStatus(room))
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"cacing/protocol"
+)
+
+func TestHostControls(t *testing.T) {
+	s, url := newTestServer(t)
+	s.Lock.Lock()
+	s.Countdown = 0
+	s.Lock.Unlock()
+
+	host := dialClient(t, url, "", protocol.ConnectRequest{Name: "host"})
+	host.send(t, protocol.TypeCreate, nil)
+	var room protocol.Room
+	json.Unmarshal(host.reply(t, protocol.TypeCreate).Data.(json.RawMessage), &room)
+	if room.Status.State != protocol.RoomLobby || room.Status.Host != host.id {
+		t.Fatalf("new room: %+v", room.Status)
+	}
+
+	guest := dialClient(t, url, "", protocol.ConnectRequest{Name: "guest"})
+	guest.send(t, protocol.TypeJoin, protocol.JoinRequest{Room: room.ID})
+	guest.reply(t, protocol.TypeJoin)
+
+	expect := func(c *testClient, typ string, data any, code string) {
+		t.Helper()
+		c.send(t, typ, data)
+		if got := failCode(c.reply(t, typ)); got != code {
+			t.Fatalf("%s: got %q, want %q", typ, got, code)
+		}
+	}
+	expect(guest, protocol.TypeStart, nil, protocol.ErrNotHost)
+	expect(host, protocol.TypeResume, nil, protocol.ErrWrongState)
+	capacity := 3
+	expect(host, protocol.TypeSettings, protocol.SettingsRequest{Capacity: &capacity}, "")
+	expect(host, protocol.TypeStart, nil, "")
+	var status protocol.RoomStatus
+	for status.State != protocol.RoomPlaying {
+		guest.event(t, protocol.EventState, &status)
+	}
+	expect(host, protocol.TypeSettings, protocol.SettingsRequest{Capacity: &capacity}, protocol.ErrWrongState)
+
+	late := dialClient(t, url, "", protocol.ConnectRequest{Name: "late"})
+	expect(host, protocol.TypeLock, protocol.LockRequest{Locked: true}, "")
+	expect(late, protocol.TypeJoin, protocol.JoinRequest{Room: room.ID}, protocol.ErrRoomLocked)
+	expect(host, protocol.TypeLock, protocol.LockRequest{Locked: false}, "")
+
+	expect(host, protocol.TypeKick, protocol.KickRequest{Player: guest.id}, "")
+	var kicked protocol.RoomClosed
+	guest.event(t, protocol.EventKicked, &kicked)
+	expect(guest, protocol.TypeJoin, protocol.JoinRequest{Room: room.ID}, protocol.ErrKicked)
+
+	// the host drops, the next connected player takes over
+	expect(late, protocol.TypeJoin, protocol.JoinRequest{Room: room.ID}, "")
+	host.conn.Close()
+	for status.Host != late.id {
+		late.event(t, protocol.EventState, &status)
+	}
+}
+
+func TestShrinkArena(t *testing.T) {
+	rs := newServer(defaultConfig()).RoomDefaults
+	outside := &Snake{Body: []Vector2{{X: 30, Y: 5}, {X: 31, Y: 5}, {X: 32, Y: 5}}, BodyLen: 3}
+	outside.Prev = moveRecord{Tick: 7, Body: outside.Body, BodyLen: 3}
+	crossing := &Snake{Body: []Vector2{{X: 9, Y: 2}, {X: 10, Y: 2}}, BodyLen: 2}
+	inside := &Snake{Body: []Vector2{{X: 3, Y: 3}}, BodyLen: 1}
+	room := &Room{
+		Settings: rs,
+		Players:  []*Player{{Snake: outside}, {Snake: crossing}, {Snake: inside}, {}},
+		Foods:    []Food{{Position: Vector2{X: 2, Y: 2}}, {Position: Vector2{X: 12, Y: 2}}},
+	}
+
+	rs.ArenaWidth, rs.ArenaHeight = 10, 10
+	room.applySettings(rs)
+	for i, snake := range []*Snake{outside, crossing, inside} {
+		if !snake.inside(10, 10) {
+			t.Errorf("snake %d still outside the arena: %v", i, snake.Body)
+		}
+	}
+	if outside.BodyLen != 3 || outside.Prev.Body != nil {
+		t.Errorf("respawned snake lost its length or kept its last move: %+v", outside)
+	}
+	if inside.Body[0] != (Vector2{X: 3, Y: 3}) {
+		t.Errorf("snake inside the arena moved to %v", inside.Body)
+	}
+	if len(room.Foods) != 1 {
+		t.Errorf("food outside the arena kept: %v", room.Foods)
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"time"
+
+	"cacing/protocol"
+)
+
+// Default upper bound of the window in which a late input can still change the last move
+const INPUT_GRACE = 60 * time.Millisecond
+
+// Snake state right before the move that produced Tick, kept to re-simulate a late input.
+// move() always allocates a new body, so keeping the old slice costs nothing.
+type moveRecord struct {
+	Tick      uint64
+	Body      []Vector2
+	BodyLen   int
+	Direction int
+}
+
+// How late an input of this player may arrive: half its round trip, capped by InputGrace
+func (s *Server) inputGrace(p *Player) time.Duration {
+	grace := p.RTT / 2
+	if grace > s.InputGrace {
+		grace = s.InputGrace
+	}
+	return grace
+}
+
+// Apply an input stamped for tick. If that tick was just simulated and the input is
+// inside the player's grace window, the snake's move is re-simulated with the new
+// direction, otherwise the input applies to the next tick as usual (call under lock).
+func (s *Server) applyInput(p *Player, dir int, tick uint64) {
+	snake := p.Snake
+	room := p.Room
+
+	// a paused or ended match must not move on a late input
+	late := room != nil && room.State == protocol.RoomPlaying && tick != 0 && tick == room.Tick &&
+		snake.Prev.Tick == tick && time.Since(room.TickAt) <= s.inputGrace(p)
+	// only rewind plain moves, eating or dying changed more than the snake itself
+	if late && !snake.Dead && snake.BodyLen == snake.Prev.BodyLen && dir != snake.Prev.Direction &&
+		((snake.Prev.Direction+2)%4 != dir || snake.Prev.BodyLen <= 1) {
+		snake.Body = snake.Prev.Body
+		snake.Direction = dir
+		snake.move(room.Settings.ArenaWidth, room.Settings.ArenaHeight)
+		snake.checkSelfCollision()
+		s.checkFoodCollision(p)
+		s.checkSnakesCollision(p)
+		return
+	}
+
+	if (snake.Direction+2)%4 != dir || snake.BodyLen <= 1 {
+		snake.Direction = dir
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"cacing/protocol"
+)
+
+func TestInputRejectsUnknownDirection(t *testing.T) {
+	_, url := newTestServer(t)
+
+	c := dialClient(t, url, "", protocol.ConnectRequest{Name: "c"})
+	c.send(t, protocol.TypeCreate, nil)
+	c.reply(t, protocol.TypeCreate)
+	for _, dir := range []int{-1, DIRECTIONS, 42} {
+		c.send(t, protocol.TypeInput, protocol.InputRequest{Dir: dir})
+		if got := failCode(c.reply(t, protocol.TypeInput)); got != protocol.ErrBadPayload {
+			t.Errorf("dir %d: got %q", dir, got)
+		}
+	}
+}
+
+func TestLateInputResimulates(t *testing.T) {
+	s := newServer(defaultConfig())
+	prevBody := []Vector2{{5, 5}, {4, 5}, {3, 5}}
+	movedBody := []Vector2{{6, 5}, {5, 5}, {4, 5}}
+
+	for _, tc := range []struct {
+		name  string
+		setup func(r *Room, sn *Snake)
+		dir   int
+		tick  uint64
+		body  []Vector2 // nil when the move must stay as it was
+		want  int       // direction afterwards
+	}{
+		{"turn", nil, 1, 5, []Vector2{{5, 6}, {5, 5}, {4, 5}}, 1},
+		{"same direction", nil, 0, 5, nil, 0},
+		{"reversal", nil, 2, 5, nil, 0},
+		{"not stamped", nil, 1, 0, nil, 1},
+		{"old tick", nil, 1, 4, nil, 1},
+		{"too late", func(r *Room, sn *Snake) { r.TickAt = time.Now().Add(-time.Second) }, 1, 5, nil, 1},
+		{"ate", func(r *Room, sn *Snake) { sn.BodyLen++ }, 1, 5, nil, 1},
+		{"died", func(r *Room, sn *Snake) { sn.Dead = true }, 1, 5, nil, 1},
+		{"paused", func(r *Room, sn *Snake) { r.State = protocol.RoomPaused }, 1, 5, nil, 1},
+	} {
+		room := &Room{State: protocol.RoomPlaying, Tick: 5, TickAt: time.Now(), Settings: s.RoomDefaults}
+		snake := &Snake{
+			Body:      slices.Clone(movedBody),
+			BodyLen:   3,
+			Direction: 0,
+			Prev:      moveRecord{Tick: 5, Body: slices.Clone(prevBody), BodyLen: 3, Direction: 0},
+		}
+		p := &Player{ID: 1, Room: room, Snake: snake, RTT: 100 * time.Millisecond}
+		room.Players = []*Player{p}
+		if tc.setup != nil {
+			tc.setup(room, snake)
+		}
+
+		s.applyInput(p, tc.dir, tc.tick)
+		want := tc.body
+		if want == nil {
+			want = movedBody
+		}
+		if !slices.Equal(snake.Body, want) || snake.Direction != tc.want {
+			t.Errorf("%s: body %v dir %d, want %v dir %d", tc.name, snake.Body, snake.Direction, want, tc.want)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"time"
+
+	"cacing/protocol"
+)
+
+// Countdown from the lobby to the match, snakes stay put until it ends
+const START_COUNTDOWN = 3 * time.Second
+const MAX_START_COUNTDOWN = time.Minute
+
+// ready: toggle the player's readiness in the lobby, the room notices on its next tick
+func (s *Server) handleReady(conn *Conn, messageType int, incoming protocol.Envelope, p *Player) {
+	if p == nil {
+		sendFail(conn, messageType, incoming, protocol.ErrNotConnected, "Connect first to access ready.")
+		return
+	}
+	var req protocol.ReadyRequest
+	if err := json.Unmarshal(incoming.Data, &req); err != nil {
+		sendFail(conn, messageType, incoming, protocol.ErrBadPayload, "Failed to parse ready data")
+		return
+	}
+
+	s.Lock.Lock()
+	room := p.Room
+	if room == nil {
+		s.Lock.Unlock()
+		sendFail(conn, messageType, incoming, protocol.ErrNotInRoom, "Join a room first to access ready.")
+		return
+	}
+	if room.started() {
+		s.Lock.Unlock()
+		sendFail(conn, messageType, incoming, protocol.ErrWrongState, "The match already started.")
+		return
+	}
+	p.Ready = req.Ready
+	s.Lock.Unlock()
+
+	sendResponse(conn, messageType, incoming, protocol.TypeOk, true)
+}
+
+// Past the lobby and the countdown (call under lock)
+func (r *Room) started() bool {
+	return r.State == protocol.RoomPlaying || r.State == protocol.RoomPaused
+}
+
+// Enough of the connected players are ready, nobody connected is never enough (call under lock)
+func (r *Room) quorumReady() bool {
+	connected, ready := 0, 0
+	for _, p := range r.Players {
+		if p.Socket == nil {
+			continue
+		}
+		connected++
+		if p.Ready {
+			ready++
+		}
+	}
+	return connected > 0 && ready*100 >= connected*r.Settings.ReadyQuorum
+}
+
+// Start counting down to the match, forced when the host didn't wait for
+// everyone to be ready (call under lock)
+func (r *Room) beginCountdown(now time.Time, countdown time.Duration, forced bool) {
+	r.State = protocol.RoomStarting
+	r.StartAt = now.Add(countdown)
+	r.StartLeft = -1
+	r.Forced = forced
+}
+
+// Drive the lobby of a room on every tick: start the countdown once the
+// quorum is ready, call it off when readiness drops, announce every second
+// and start the match at the end. Returns the events for the room (call under lock)
+func (s *Server) lobbyTick(room *Room, now time.Time) []writeJob {
+	switch room.State {
+	case protocol.RoomLobby:
+		if !room.quorumReady() {
+			return nil
+		}
+		room.beginCountdown(now, s.Countdown, false)
+		gameLog.Info("players ready, counting down", "room", room.UniqeID, "countdown", s.Countdown)
+
+	case protocol.RoomStarting:
+		if !room.Forced && !room.quorumReady() {
+			room.State = protocol.RoomLobby
+			gameLog.Info("countdown cancelled, not enough players ready", "room", room.UniqeID)
+			return roomEvent(room, protocol.EventState, roomStatus(room))
+		}
+		if !now.Before(room.StartAt) {
+			room.State = protocol.RoomPlaying
+			for _, p := range room.Players {
+				p.Ready = false
+			}
+			gameLog.Info("match started", "room", room.UniqeID, "players", len(room.Players))
+			return roomEvent(room, protocol.EventState, roomStatus(room))
+		}
+
+	default:
+		return nil
+	}
+
+	// whole seconds left, rounded up so the last announcement is 1
+	left := int((room.StartAt.Sub(now) + time.Second - 1) / time.Second)
+	if left == room.StartLeft {
+		return nil
+	}
+	var jobs []writeJob
+	if room.StartLeft < 0 {
+		// first announcement, the state changed too
+		jobs = roomEvent(room, protocol.EventState, roomStatus(room))
+	}
+	room.StartLeft = left
+	return append(jobs, roomEvent(room, protocol.EventCountdown, protocol.RoomCountdown{
+		Room:        room.UniqeID,
+		SecondsLeft: left,
+		StartsAt:    room.StartAt.UnixMilli(),
+	})...)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"cacing/protocol"
+)
+
+func TestLobbyReadyCountdown(t *testing.T) {
+	s, url := newTestServer(t)
+	s.Lock.Lock()
+	s.Countdown = 500 * time.Millisecond
+	s.Lock.Unlock()
+
+	host := dialClient(t, url, "", protocol.ConnectRequest{Name: "host"})
+	host.send(t, protocol.TypeCreate, nil)
+	var room protocol.Room
+	json.Unmarshal(host.reply(t, protocol.TypeCreate).Data.(json.RawMessage), &room)
+	guest := dialClient(t, url, "", protocol.ConnectRequest{Name: "guest"})
+	guest.send(t, protocol.TypeJoin, protocol.JoinRequest{Room: room.ID})
+	guest.reply(t, protocol.TypeJoin)
+
+	ready := func(c *testClient, ready bool, code string) {
+		t.Helper()
+		c.send(t, protocol.TypeReady, protocol.ReadyRequest{Ready: ready})
+		if got := failCode(c.reply(t, protocol.TypeReady)); got != code {
+			t.Fatalf("ready %v: got %q, want %q", ready, got, code)
+		}
+	}
+	state := func(want string) {
+		t.Helper()
+		var status protocol.RoomStatus
+		for status.State != want {
+			guest.event(t, protocol.EventState, &status)
+		}
+	}
+
+	// everyone has to be ready, backing out calls the countdown off
+	ready(host, true, "")
+	ready(guest, true, "")
+	state(protocol.RoomStarting)
+	var countdown protocol.RoomCountdown
+	guest.event(t, protocol.EventCountdown, &countdown)
+	if countdown.Room != room.ID || countdown.SecondsLeft != 1 {
+		t.Fatalf("countdown: %+v", countdown)
+	}
+	ready(host, false, "")
+	state(protocol.RoomLobby)
+
+	ready(host, true, "")
+	state(protocol.RoomStarting)
+	state(protocol.RoomPlaying)
+	ready(guest, false, protocol.ErrWrongState)
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"strings"
+)
+
+// Subsystems with their own logger and level
+const (
+	LOG_SERVER  = "server"  // startup, config, tls, shutdown
+	LOG_WS      = "ws"      // connections and client messages
+	LOG_GAME    = "game"    // rooms and the game loop
+	LOG_CLEANUP = "cleanup" // eviction of timed out players
+	LOG_HTTP    = "http"    // client files, origin checks
+)
+
+var LOG_SUBSYSTEMS = []string{LOG_SERVER, LOG_WS, LOG_GAME, LOG_CLEANUP, LOG_HTTP}
+
+// Logger of every subsystem, replaced by setupLogging
+var (
+	serverLog  = slog.Default().With("subsystem", LOG_SERVER)
+	wsLog      = slog.Default().With("subsystem", LOG_WS)
+	gameLog    = slog.Default().With("subsystem", LOG_GAME)
+	cleanupLog = slog.Default().With("subsystem", LOG_CLEANUP)
+	httpLog    = slog.Default().With("subsystem", LOG_HTTP)
+)
+
+// Point every subsystem logger at out, in text or JSON, each with its level:
+// the one of levels (like "ws=debug") or else the default level
+func setupLogging(out io.Writer, format string, level string, levels []string) error {
+	defaultLevel, err := parseLevel(level)
+	if err != nil {
+		return err
+	}
+	perSubsystem, err := parseSubsystemLevels(levels)
+	if err != nil {
+		return err
+	}
+
+	// the base handler lets everything through, levelHandler filters per subsystem
+	opts := &slog.HandlerOptions{Level: slog.LevelDebug}
+	var base slog.Handler = slog.NewTextHandler(out, opts)
+	if format == "json" {
+		base = slog.NewJSONHandler(out, opts)
+	}
+
+	logger := func(name string) *slog.Logger {
+		l, ok := perSubsystem[name]
+		if !ok {
+			l = defaultLevel
+		}
+		return slog.New(levelHandler{level: l, Handler: base}).With("subsystem", name)
+	}
+	serverLog = logger(LOG_SERVER)
+	wsLog = logger(LOG_WS)
+	gameLog = logger(LOG_GAME)
+	cleanupLog = logger(LOG_CLEANUP)
+	httpLog = logger(LOG_HTTP)
+
+	// anything still using the log package ends up in the same stream
+	slog.SetDefault(slog.New(levelHandler{level: defaultLevel, Handler: base}))
+	return nil
+}
+
+func parseLevel(s string) (slog.Level, error) {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(s)); err != nil {
+		return 0, fmt.Errorf("log level %q: use debug, info, warn or error", s)
+	}
+	return l, nil
+}
+
+// "ws=debug" entries into subsystem -> level
+func parseSubsystemLevels(levels []string) (map[string]slog.Level, error) {
+	out := map[string]slog.Level{}
+	for _, entry := range levels {
+		name, value, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("log level %q: expected subsystem=level", entry)
+		}
+		if !slices.Contains(LOG_SUBSYSTEMS, name) {
+			return nil, fmt.Errorf("log level %q: unknown subsystem, use one of %s", entry, strings.Join(LOG_SUBSYSTEMS, ", "))
+		}
+		l, err := parseLevel(value)
+		if err != nil {
+			return nil, err
+		}
+		out[name] = l
+	}
+	return out, nil
+}
+
+// Handler with its own minimum level in front of a shared handler
+type levelHandler struct {
+	level slog.Level
+	slog.Handler
+}
+
+func (h levelHandler) Enabled(_ context.Context, l slog.Level) bool {
+	return l >= h.level
+}
+
+func (h levelHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return levelHandler{level: h.level, Handler: h.Handler.WithAttrs(attrs)}
+}
+
+func (h levelHandler) WithGroup(name string) slog.Handler {
+	return levelHandler{level: h.level, Handler: h.Handler.WithGroup(name)}
+}
@@ -1,31 +1,108 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
-
-	"github.com/gorilla/websocket"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
 // Websocket server setup and main function
 func main() {
-	port := 8080
-	var s = Server {
-		Upgrade: websocket.Upgrader{
-			ReadBufferSize:  1024,
-			WriteBufferSize: 1024,
-			CheckOrigin: func(r *http.Request) bool {
-				return true
-			},
-		},
-		Counter: 0,
+	cfg, printConfig, err := loadConfig(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatalf("Invalid config: %v", err)
+	}
+	if printConfig {
+		out, _ := json.MarshalIndent(cfg.redacted(), "", "  ")
+		os.Stdout.Write(append(out, '\n'))
+		return
+	}
+	if err := setupLogging(os.Stderr, cfg.LogFormat, cfg.LogLevel, cfg.LogLevels); err != nil {
+		log.Fatalf("Invalid config: %v", err)
 	}
 
-	go s.updateGame()
-	go s.cleanUpService()
+	s := newServer(cfg)
+	s.start()
 
 	http.HandleFunc("/ws", s.handleConnection)
-	log.Printf("Hosted at: ws://locahost:%d\n", port)
-	log.Fatal(http.ListenAndServe(fmt.Sprintf(":%d", port), nil))
+	http.HandleFunc("GET /metrics", s.handleMetrics)
+	http.HandleFunc("GET /healthz", s.handleHealthz)
+	http.HandleFunc("GET /readyz", s.handleReadyz)
+	http.HandleFunc("GET /api/info", s.handleInfo)
+	http.HandleFunc("GET /api/rooms", s.handleRooms)
+	if cfg.AdminToken != "" {
+		s.registerAdmin(http.DefaultServeMux, cfg.AdminToken)
+	}
+	files, err := clientFS(cfg.Client, cfg.ClientDir)
+	if err != nil {
+		fatal("invalid config", err)
+	}
+	if files != nil {
+		http.Handle("/", newClientHandler(files, cfg.ClientDir == ""))
+	}
+	tlsCfg, err := tlsConfig(cfg)
+	if err != nil {
+		fatal("TLS setup failed", err)
+	}
+	srv := &http.Server{Addr: cfg.addr(), TLSConfig: tlsCfg}
+
+	var redirect *http.Server
+	if tlsCfg != nil && cfg.HTTPRedirectPort != 0 {
+		redirect = redirectServer(fmt.Sprintf("%s:%d", cfg.Host, cfg.HTTPRedirectPort), cfg.Port)
+		go func() {
+			if err := redirect.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+				fatal("HTTP redirect server failed", err)
+			}
+		}()
+	}
+
+	go func() {
+		var err error
+		if tlsCfg != nil {
+			serverLog.Info("hosted", "url", "wss://"+cfg.publicAddr()+"/ws")
+			err = srv.ListenAndServeTLS("", "")
+		} else {
+			serverLog.Info("hosted", "url", "ws://"+cfg.publicAddr()+"/ws")
+			err = srv.ListenAndServe()
+		}
+		if !errors.Is(err, http.ErrServerClosed) {
+			fatal("HTTP server failed", err)
+		}
+	}()
+
+	// first signal drains, a second one kills the process right away
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	<-ctx.Done()
+	stop()
+	serverLog.Info("shutting down, signal again to exit immediately")
+
+	// keep serving while draining so dropped players can still reconnect
+	s.drain(time.Duration(cfg.ShutdownTimeout))
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		serverLog.Warn("HTTP shutdown", "err", err)
+	}
+	if redirect != nil {
+		_ = redirect.Shutdown(shutdownCtx)
+	}
+	s.stop(shutdownCtx)
+	serverLog.Info("bye")
+}
+
+func fatal(msg string, err error) {
+	serverLog.Error(msg, "err", err)
+	os.Exit(1)
 }
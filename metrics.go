@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"cacing/protocol"
+)
+
+// Upper bounds of the tick duration histogram, in seconds
+var TICK_BUCKETS = []float64{0.0001, 0.00025, 0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1}
+
+// Counters of the server, exposed on /metrics in the Prometheus text format.
+// Gauges (sockets, players, rooms) are read from the registry at scrape time.
+type Metrics struct {
+	BytesSent     atomic.Uint64
+	WriteErrors   atomic.Uint64
+	DroppedFrames atomic.Uint64 // room frames a client never got, it needs a keyframe
+	Reconnects    atomic.Uint64
+	Deaths        atomic.Uint64
+
+	lock        sync.Mutex
+	messagesIn  map[string]uint64
+	messagesOut map[string]uint64
+	ticks       histogram // of every room, room codes stay off the public endpoint
+}
+
+type histogram struct {
+	counts []uint64 // per bucket, not cumulative
+	sum    float64
+	count  uint64
+}
+
+func newMetrics() *Metrics {
+	return &Metrics{
+		messagesIn:  map[string]uint64{},
+		messagesOut: map[string]uint64{},
+		ticks:       histogram{counts: make([]uint64, len(TICK_BUCKETS))},
+	}
+}
+
+// Count a message from a client, types we don't know are lumped together
+// so clients can't blow up the label set
+func (m *Metrics) messageIn(typ string) {
+	if !slices.Contains(protocol.Enums["RequestType"], typ) {
+		typ = "unknown"
+	}
+	m.lock.Lock()
+	m.messagesIn[typ]++
+	m.lock.Unlock()
+}
+
+// Count a message to a client by its type (response data type or event)
+func (m *Metrics) messageOut(typ string) {
+	m.lock.Lock()
+	m.messagesOut[typ]++
+	m.lock.Unlock()
+}
+
+// Record how long a room took to simulate and encode a tick
+func (m *Metrics) observeTick(d time.Duration) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	h := &m.ticks
+	seconds := d.Seconds()
+	if i, _ := slices.BinarySearch(TICK_BUCKETS, seconds); i < len(TICK_BUCKETS) {
+		h.counts[i]++
+	}
+	h.sum += seconds
+	h.count++
+}
+
+// GET /metrics
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	s.Lock.Lock()
+	sockets := len(s.Sockets)
+	connected := 0
+	for _, p := range s.Players {
+		if p.Socket != nil {
+			connected++
+		}
+	}
+	disconnected := len(s.Players) - connected
+	rooms := len(s.Rooms)
+	s.Lock.Unlock()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m := s.Metrics
+
+	writeMetric(w, "snake_sockets", "gauge", "Open websocket connections.")
+	fmt.Fprintf(w, "snake_sockets %d\n", sockets)
+	writeMetric(w, "snake_players", "gauge", "Known players by connection state.")
+	fmt.Fprintf(w, "snake_players{state=\"connected\"} %d\n", connected)
+	fmt.Fprintf(w, "snake_players{state=\"disconnected\"} %d\n", disconnected)
+	writeMetric(w, "snake_rooms", "gauge", "Running rooms.")
+	fmt.Fprintf(w, "snake_rooms %d\n", rooms)
+
+	writeCounter(w, "snake_bytes_sent_total", "Bytes written to websockets.", m.BytesSent.Load())
+	writeCounter(w, "snake_write_errors_total", "Failed websocket writes.", m.WriteErrors.Load())
+	writeCounter(w, "snake_dropped_frames_total", "Room frames that could not be delivered.", m.DroppedFrames.Load())
+	writeCounter(w, "snake_reconnects_total", "Successful reconnects.", m.Reconnects.Load())
+	writeCounter(w, "snake_deaths_total", "Snakes that died.", m.Deaths.Load())
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	writeMetric(w, "snake_messages_in_total", "counter", "Messages received by type.")
+	for _, typ := range sortedKeys(m.messagesIn) {
+		fmt.Fprintf(w, "snake_messages_in_total{type=%s} %d\n", labelValue(typ), m.messagesIn[typ])
+	}
+	writeMetric(w, "snake_messages_out_total", "counter", "Messages sent by type.")
+	for _, typ := range sortedKeys(m.messagesOut) {
+		fmt.Fprintf(w, "snake_messages_out_total{type=%s} %d\n", labelValue(typ), m.messagesOut[typ])
+	}
+
+	writeMetric(w, "snake_room_tick_seconds", "histogram", "Time to simulate and encode one tick of a room.")
+	var cumulative uint64
+	for i, le := range TICK_BUCKETS {
+		cumulative += m.ticks.counts[i]
+		fmt.Fprintf(w, "snake_room_tick_seconds_bucket{le=\"%s\"} %d\n", strconv.FormatFloat(le, 'g', -1, 64), cumulative)
+	}
+	fmt.Fprintf(w, "snake_room_tick_seconds_bucket{le=\"+Inf\"} %d\n", m.ticks.count)
+	fmt.Fprintf(w, "snake_room_tick_seconds_sum %s\n", strconv.FormatFloat(m.ticks.sum, 'g', -1, 64))
+	fmt.Fprintf(w, "snake_room_tick_seconds_count %d\n", m.ticks.count)
+}
+
+func writeMetric(w io.Writer, name, kind, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+func writeCounter(w io.Writer, name, help string, v uint64) {
+	writeMetric(w, name, "counter", help)
+	fmt.Fprintf(w, "%s %d\n", name, v)
+}
+
+// Quoted and escaped label value
+func labelValue(v string) string {
+	v = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+	return `"` + v + `"`
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"cacing/protocol"
+)
+
+func TestMetricsExposition(t *testing.T) {
+	s, url := newTestServer(t)
+
+	c := dialClient(t, url, "", protocol.ConnectRequest{Name: "m"})
+	c.send(t, protocol.TypeCreate, &protocol.CreateRequest{Password: "hunter22"})
+	var room protocol.Room
+	json.Unmarshal(c.reply(t, protocol.TypeCreate).Data.(json.RawMessage), &room)
+	c.send(t, "no_such_type", nil)
+	c.reply(t, "no_such_type")
+
+	rec := httptest.NewRecorder()
+	s.handleMetrics(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body := rec.Body.String()
+
+	for _, want := range []string{
+		"snake_sockets 1\n",
+		"snake_players{state=\"connected\"} 1\n",
+		"snake_rooms 1\n",
+		"snake_messages_in_total{type=\"connect\"} 1\n",
+		"snake_messages_in_total{type=\"create\"} 1\n",
+		"snake_messages_in_total{type=\"unknown\"} 1\n",
+		"snake_messages_out_total{type=\"fail\"} 1\n",
+		"# TYPE snake_room_tick_seconds histogram\n",
+		"le=\"+Inf\"}",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("missing %q in\n%s", want, body)
+		}
+	}
+
+	// the endpoint is public, private room codes must not show up on it
+	if strings.Contains(body, `"`+room.ID+`"`) {
+		t.Errorf("room code %s exposed in\n%s", room.ID, body)
+	}
+
+	sample := regexp.MustCompile(`^[a-z_]+(\{[a-z]+="[^"]*"(,[a-z]+="[^"]*")*\})? [0-9.e+-]+$`)
+	for _, line := range strings.Split(strings.TrimSpace(body), "\n") {
+		if !strings.HasPrefix(line, "# ") && !sample.MatchString(line) {
+			t.Errorf("malformed sample line %q", line)
+		}
+	}
+}
@@ -1,18 +1,11 @@
 package main
 
 import (
-	"encoding/json"
 	"fmt"
 	"math"
 	"math/rand"
 )
 
-// Message struct for communication
-type Message struct {
-	Type string          `json:"type"`
-	Data json.RawMessage `json:"data"`
-}
-
 // Converts HSL (0–360, 0–1, 0–1) to RGB (0–255 each)
 func HSLToRGB(h, s, l float64) (r, g, b int) {
 	c := (1 - math.Abs(2*l-1)) * s
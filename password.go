@@ -0,0 +1,104 @@
+package main
+
+import (
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"time"
+)
+
+// Longest room password in bytes
+const MAX_ROOM_PASSWORD = 64
+
+// PBKDF2 rounds of a room password, only paid on create and on join
+const ROOM_PASSWORD_ITERATIONS = 100_000
+
+// Failed joins (unknown room or wrong password) a connection may make before
+// it has to wait, the wait doubles with every further failure up to JOIN_MAX_LOCKOUT.
+// Failures are forgotten after JOIN_FAIL_WINDOW without one.
+const JOIN_MAX_FAILS = 5
+
+// Same for every connection from one client address together. Higher, since
+// players behind one NAT or proxy share it and a new socket starts over
+// with its own JOIN_MAX_FAILS.
+const JOIN_MAX_FAILS_PER_ADDR = 30
+const JOIN_LOCKOUT = 5 * time.Second
+const JOIN_MAX_LOCKOUT = 5 * time.Minute
+const JOIN_FAIL_WINDOW = 15 * time.Minute
+
+// Salted hash of a room password, the password itself is never kept
+type roomPassword struct {
+	Salt []byte
+	Hash []byte
+}
+
+func hashRoomPassword(password string) (*roomPassword, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	hash, err := pbkdf2.Key(sha256.New, password, salt, ROOM_PASSWORD_ITERATIONS, sha256.Size)
+	if err != nil {
+		return nil, err
+	}
+	return &roomPassword{Salt: salt, Hash: hash}, nil
+}
+
+// Whether password matches, in constant time
+func (rp *roomPassword) check(password string) bool {
+	hash, err := pbkdf2.Key(sha256.New, password, rp.Salt, ROOM_PASSWORD_ITERATIONS, sha256.Size)
+	return err == nil && subtle.ConstantTimeCompare(hash, rp.Hash) == 1
+}
+
+// Failed join attempts of one connection, or of one client address in
+// Server.JoinFails so a new socket doesn't clear them. A successful join
+// clears neither.
+type joinLimiter struct {
+	limit int // failures before the lockout
+	fails int
+	last  time.Time // last failure
+	until time.Time
+}
+
+// How long joins are still refused, 0 when the connection may try
+func (l *joinLimiter) wait(now time.Time) time.Duration {
+	return max(l.until.Sub(now), 0)
+}
+
+func (l *joinLimiter) fail(now time.Time) {
+	if l.stale(now) {
+		*l = joinLimiter{limit: l.limit}
+	}
+	l.fails++
+	l.last = now
+	if l.fails < l.limit {
+		return
+	}
+	lockout := JOIN_LOCKOUT << min(l.fails-l.limit, 10)
+	l.until = now.Add(min(lockout, JOIN_MAX_LOCKOUT))
+}
+
+// No lockout left and no failure within JOIN_FAIL_WINDOW
+func (l *joinLimiter) stale(now time.Time) bool {
+	return !now.Before(l.until) && now.Sub(l.last) > JOIN_FAIL_WINDOW
+}
+
+// How long joins from addr are still refused (call under lock)
+func (s *Server) joinWait(addr string, now time.Time) time.Duration {
+	if l := s.JoinFails[addr]; l != nil {
+		return l.wait(now)
+	}
+	return 0
+}
+
+// Count a failed join from addr, returns the failures so far (call under lock)
+func (s *Server) joinFailed(addr string, now time.Time) int {
+	l := s.JoinFails[addr]
+	if l == nil {
+		l = &joinLimiter{limit: JOIN_MAX_FAILS_PER_ADDR}
+		s.JoinFails[addr] = l
+	}
+	l.fail(now)
+	return l.fails
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"cacing/protocol"
+)
+
+func TestRoomCode(t *testing.T) {
+	seen := map[string]bool{}
+	for i := 0; i < 1000; i++ {
+		code := roomCode()
+		if len(code) != ROOM_CODE_LEN || strings.Trim(code, ROOM_CODE_ALPHABET) != "" {
+			t.Fatalf("bad room code %q", code)
+		}
+		seen[code] = true
+	}
+	if len(seen) < 990 {
+		t.Fatalf("only %d distinct codes out of 1000", len(seen))
+	}
+}
+
+func TestJoinPassword(t *testing.T) {
+	_, url := newTestServer(t)
+
+	host := dialClient(t, url, "", protocol.ConnectRequest{Name: "host"})
+	host.send(t, protocol.TypeCreate, protocol.CreateRequest{Password: "hunter2"})
+	var room protocol.Room
+	json.Unmarshal(host.reply(t, protocol.TypeCreate).Data.(json.RawMessage), &room)
+	if !room.Password {
+		t.Fatalf("room not marked as password protected: %+v", room)
+	}
+
+	guest := dialClient(t, url, "", protocol.ConnectRequest{Name: "guest"})
+	for _, password := range []string{"", "hunter3"} {
+		guest.send(t, protocol.TypeJoin, protocol.JoinRequest{Room: room.ID, Password: password})
+		if code := failCode(guest.reply(t, protocol.TypeJoin)); code != protocol.ErrWrongPassword {
+			t.Fatalf("password %q: got %q, want %s", password, code, protocol.ErrWrongPassword)
+		}
+	}
+	guest.send(t, protocol.TypeJoin, protocol.JoinRequest{Room: room.ID, Password: "hunter2"})
+	if resp := guest.reply(t, protocol.TypeJoin); resp.Type != protocol.TypeSnake {
+		t.Fatalf("right password refused: %s", resp.Data)
+	}
+
+	solo := dialClient(t, url, "", protocol.ConnectRequest{Name: "solo"})
+	solo.send(t, protocol.TypeCreate, protocol.CreateRequest{Capacity: 1})
+	var full protocol.Room
+	json.Unmarshal(solo.reply(t, protocol.TypeCreate).Data.(json.RawMessage), &full)
+
+	guesser := dialClient(t, url, "", protocol.ConnectRequest{Name: "guesser"})
+	// bouncing off a full room or joining and leaving doesn't wipe the slate
+	guesser.send(t, protocol.TypeJoin, protocol.JoinRequest{Room: full.ID})
+	if code := failCode(guesser.reply(t, protocol.TypeJoin)); code != protocol.ErrRoomFull {
+		t.Fatalf("full room: got %q", code)
+	}
+	guesser.send(t, protocol.TypeJoin, protocol.JoinRequest{Room: room.ID, Password: "hunter2"})
+	guesser.reply(t, protocol.TypeJoin)
+	guesser.send(t, protocol.TypeDisconnect, nil)
+	guesser.reply(t, protocol.TypeDisconnect)
+	guess := func(c *testClient, want string) {
+		t.Helper()
+		c.send(t, protocol.TypeJoin, protocol.JoinRequest{Room: "-----"})
+		if code := failCode(c.reply(t, protocol.TypeJoin)); code != want {
+			t.Fatalf("guess: got %q, want %s", code, want)
+		}
+	}
+	for i := 0; i < JOIN_MAX_FAILS; i++ {
+		guess(guesser, protocol.ErrRoomNotFound)
+	}
+	// guessing codes gets the connection throttled, even for the right one
+	guesser.send(t, protocol.TypeJoin, protocol.JoinRequest{Room: room.ID, Password: "hunter2"})
+	if code := failCode(guesser.reply(t, protocol.TypeJoin)); code != protocol.ErrRateLimited {
+		t.Fatalf("after %d failures: got %q, want %s", JOIN_MAX_FAILS, code, protocol.ErrRateLimited)
+	}
+
+	// every client here comes from 127.0.0.1, a new socket gets its own
+	// allowance until the address as a whole ran out of it
+	addrFails := 2 + JOIN_MAX_FAILS
+	for addrFails < JOIN_MAX_FAILS_PER_ADDR {
+		c := dialClient(t, url, "", protocol.ConnectRequest{Name: "sybil"})
+		for i := 0; i < JOIN_MAX_FAILS-1 && addrFails < JOIN_MAX_FAILS_PER_ADDR; i++ {
+			guess(c, protocol.ErrRoomNotFound)
+			addrFails++
+		}
+	}
+	guess(dialClient(t, url, "", protocol.ConnectRequest{Name: "fresh"}), protocol.ErrRateLimited)
+}
+
+func TestJoinLimiterForgets(t *testing.T) {
+	now := time.Now()
+	l := joinLimiter{limit: JOIN_MAX_FAILS}
+	for i := 0; i < JOIN_MAX_FAILS; i++ {
+		l.fail(now)
+	}
+	if l.wait(now) != JOIN_LOCKOUT || l.stale(now) {
+		t.Fatalf("after %d failures: wait %v", JOIN_MAX_FAILS, l.wait(now))
+	}
+	// a quiet connection or address starts over
+	later := now.Add(JOIN_FAIL_WINDOW + time.Second)
+	if !l.stale(later) {
+		t.Fatal("limiter never goes stale")
+	}
+	l.fail(later)
+	if l.fails != 1 || l.wait(later) != 0 {
+		t.Errorf("failures not forgotten: %d, wait %v", l.fails, l.wait(later))
+	}
+}
@@ -2,8 +2,6 @@ package main
 
 import (
 	"time"
-
-	"github.com/gorilla/websocket"
 )
 
 // Data that let only server knows
@@ -11,15 +9,14 @@ type Player struct {
 	ID              int              `json:"id"`
 	Name            string           `json:"name"`
 	Room            *Room            `json:"-"`
-	UniqeID         string           `json:"unique_id"`
+	Queued          *Room            `json:"-"` // room whose waiting queue the player is in
+	Ready           bool             `json:"-"` // ready to start, in the lobby
+	Token           string           `json:"-"` // session secret, never broadcasted
+	TokenExpires    time.Time        `json:"-"`
 	Snake           *Snake           `json:"snake"`
-	Socket          *websocket.Conn  `json:"-"`
+	Socket          *Conn            `json:"-"`
 	LastActive      time.Time        `json:"-"`
-}
-
-// Data that is safe to be broadcasted
-type PlayerPublic struct {
-	ID      int    `json:"id"`
-	Name    string `json:"name"`
-	UniqeID string `json:"unique_id"`
+	Sync            clientSync       `json:"-"`
+	RTT             time.Duration    `json:"-"` // last ping round trip
+	Addr            string           `json:"-"` // remote ip of the current socket
 }
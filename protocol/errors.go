@@ -0,0 +1,33 @@
+package protocol
+
+// Stable error codes of fail responses, clients should switch on these and
+// never on the message text
+const (
+	ErrBadPayload         = "BAD_PAYLOAD"
+	ErrUnknownType        = "UNKNOWN_TYPE"
+	ErrUnsupportedVersion = "UNSUPPORTED_VERSION"
+	ErrNotConnected       = "NOT_CONNECTED"
+	ErrAlreadyConnected   = "ALREADY_CONNECTED"
+	ErrReconnectFailed    = "RECONNECT_FAILED"
+	ErrAlreadyInRoom      = "ALREADY_IN_ROOM"
+	ErrNotInRoom          = "NOT_IN_ROOM"
+	ErrRoomNotFound       = "ROOM_NOT_FOUND"
+	ErrWrongPassword      = "WRONG_PASSWORD"
+	ErrRoomFull           = "ROOM_FULL"
+	ErrRoomLocked         = "ROOM_LOCKED"
+	ErrKicked             = "KICKED"
+	ErrNotHost            = "NOT_HOST"
+	ErrWrongState         = "WRONG_STATE"
+	ErrRateLimited        = "RATE_LIMITED"
+	ErrServerFull         = "SERVER_FULL"
+	ErrShuttingDown       = "SHUTTING_DOWN"
+	ErrInternal           = "INTERNAL"
+)
+
+// Data of a fail response
+type Fail struct {
+	Code    string         `json:"code"`
+	Message string         `json:"message"`
+	Context string         `json:"context"` // request type that failed
+	Details map[string]any `json:"details,omitempty"`
+}
@@ -0,0 +1,362 @@
+// Package protocol holds every message shape exchanged over the game websocket.
+//
+// Clients send an Envelope, the server answers a request with a Response that
+// echoes the request type and request_id, and pushes Events (broadcast_*) that
+// are not tied to any request. Types registered in Types are exported to
+// JSON Schema and TypeScript by cmd/protogen.
+package protocol
+
+import "encoding/json"
+
+// Current protocol version, bump on any breaking change of the shapes below
+const Version = 1
+
+// Oldest version the server still talks to. Clients that don't send a version
+// are treated as MinVersion.
+const MinVersion = 1
+
+// Request types (client -> server)
+const (
+	TypeConnect    = "connect"
+	TypeReconnect  = "reconnect"
+	TypeCreate     = "create"
+	TypeJoin       = "join"
+	TypeDisconnect = "disconnect"
+	TypeInput      = "input"
+	TypeResync     = "resync"
+	TypeListRooms  = "list_rooms"
+	TypeReady      = "ready"
+
+	// host only
+	TypeStart        = "start"
+	TypePause        = "pause"
+	TypeResume       = "resume"
+	TypeKick         = "kick"
+	TypeLock         = "lock"
+	TypeSettings     = "settings"
+	TypeTransferHost = "transfer_host"
+)
+
+// Response data types (server -> client, reply to a request)
+const (
+	TypePlayer = "player"
+	TypeRoom   = "room"
+	TypeSnake  = "snake"
+	TypeRooms  = "rooms"
+	TypeQueued = "queued"
+	TypeOk     = "ok"
+	TypeFail   = "fail"
+)
+
+// Player flags of PlayerView
+const (
+	FlagDisconnected = "disconnected"
+	FlagHost         = "host"
+	FlagReady        = "ready" // only in the lobby
+)
+
+// Game modes of a room
+const (
+	ModeClassic = "classic"
+)
+
+// Maps of a room, the open map is the plain arena wrapping around its edges
+const (
+	MapOpen = "open"
+)
+
+// State of a room. New rooms wait in the lobby until enough players are
+// ready or the host starts the match, then count down while starting.
+// Snakes only move while playing.
+const (
+	RoomLobby    = "lobby"
+	RoomStarting = "starting"
+	RoomPlaying  = "playing"
+	RoomPaused   = "paused"
+)
+
+// Event types (server -> client, not tied to a request)
+const (
+	EventRoom      = "broadcast_room"
+	EventDelta     = "broadcast_delta"
+	EventSnakeDead = "broadcast_snake_ded"
+	EventShutdown  = "server_shutdown"
+	EventMessage   = "server_message"
+	EventSettings  = "room_settings"
+	EventClosed    = "room_closed"
+	EventQueue     = "queue_position"
+	EventState     = "room_state"
+	EventKicked    = "room_kicked"
+	EventCountdown = "room_countdown"
+)
+
+// Every message sent by a client
+type Envelope struct {
+	Type      string          `json:"type"`
+	RequestID string          `json:"request_id,omitempty"`
+	Data      json.RawMessage `json:"data,omitempty"`
+}
+
+// Reply to a client request, Response is the request type it answers
+type Response struct {
+	Response  string `json:"response"`
+	RequestID string `json:"request_id,omitempty"`
+	Type      string `json:"type"`
+	Data      any    `json:"data"`
+}
+
+// Message pushed by the server on its own
+type Event struct {
+	Type string `json:"type"`
+	Data any    `json:"data"`
+}
+
+// Data of connect
+type ConnectRequest struct {
+	Name    string `json:"name"`
+	Version int    `json:"version,omitempty"`
+	Delta   bool   `json:"delta,omitempty"`
+}
+
+// Data of reconnect, the token is the one from the last player response
+type ReconnectRequest struct {
+	ID    int    `json:"id"`
+	Token string `json:"token"`
+}
+
+// Data of create, everything is optional. Private rooms (the default) are
+// only reachable by their code, public ones show up in list_rooms. With a
+// password, join has to send the same password. Capacity 0 is the server
+// default, with Queue a join to a full room waits for a free slot.
+type CreateRequest struct {
+	Name     string `json:"name,omitempty"`
+	Public   bool   `json:"public,omitempty"`
+	Mode     string `json:"mode,omitempty"`
+	Map      string `json:"map,omitempty"`
+	Password string `json:"password,omitempty"`
+	Capacity int    `json:"capacity,omitempty"`
+	Queue    bool   `json:"queue,omitempty"`
+}
+
+// Data of join
+type JoinRequest struct {
+	Room     string `json:"room"`
+	Password string `json:"password,omitempty"`
+}
+
+// Data of ready, in the lobby
+type ReadyRequest struct {
+	Ready bool `json:"ready"`
+}
+
+// Data of kick (host only), the player is sent back to the menu and can't
+// join the room again
+type KickRequest struct {
+	Player int `json:"player"`
+}
+
+// Data of lock (host only), a locked room refuses every join
+type LockRequest struct {
+	Locked bool `json:"locked"`
+}
+
+// Data of transfer_host (host only)
+type TransferHostRequest struct {
+	Player int `json:"player"`
+}
+
+// Data of settings (host only, in the lobby), missing fields stay as they are
+type SettingsRequest struct {
+	ArenaWidth  *int `json:"arena_width,omitempty"`
+	ArenaHeight *int `json:"arena_height,omitempty"`
+	TickMillis  *int `json:"tick_ms,omitempty"`
+	Capacity    *int `json:"capacity,omitempty"`
+	ReadyQuorum *int `json:"ready_quorum,omitempty"`
+}
+
+// Data of input. Tick is the tick the input is meant for (last tick seen + 1),
+// an input that arrives just after that tick was simulated may still apply to it.
+type InputRequest struct {
+	Dir  int    `json:"dir"`
+	Tick uint64 `json:"tick,omitempty"`
+}
+
+// Data of the player response (connect, reconnect). Token is the session secret
+// for reconnect, it is rotated on every reconnect and expires at TokenExpires (unix seconds).
+type PlayerInfo struct {
+	ID              int     `json:"id"`
+	Name            string  `json:"name"`
+	Token           string  `json:"token"`
+	TokenExpires    int64   `json:"token_expires"`
+	ProtocolVersion int     `json:"protocol_version"`
+	Resume          *Resume `json:"resume,omitempty"` // set on reconnect while still in a room
+}
+
+// Where a reconnecting player left off, with a full snapshot to rebuild the board
+type Resume struct {
+	Room     string       `json:"room"`
+	Settings RoomSettings `json:"settings"`
+	Snake    *Snake       `json:"snake"`
+	Snapshot RoomSnapshot `json:"snapshot"`
+	Status   RoomStatus   `json:"status"`
+}
+
+type RoomSettings struct {
+	ArenaWidth  int `json:"arena_width"`
+	ArenaHeight int `json:"arena_height"`
+	TickMillis  int `json:"tick_ms"`
+	Capacity    int `json:"capacity"`     // most players at once
+	ReadyQuorum int `json:"ready_quorum"` // percent of connected players that must be ready to start
+}
+
+type Vector2 struct {
+	X int `json:"x"`
+	Y int `json:"y"`
+}
+
+type Food struct {
+	Pos Vector2 `json:"pos"`
+}
+
+type Snake struct {
+	Body    []Vector2 `json:"body"`
+	BodyLen int       `json:"body_len"`
+	Dir     int       `json:"dir"`
+	Color   string    `json:"color"`
+	Dead    bool      `json:"dead"`
+}
+
+// Public view of a player, the only player shape that is ever broadcasted.
+// Server-only fields (session token, socket, ...) have no place here on purpose.
+type PlayerView struct {
+	ID    int      `json:"id"`
+	Name  string   `json:"name"`
+	Snake *Snake   `json:"snake"`
+	Team  string   `json:"team,omitempty"`
+	Score int      `json:"score"`
+	Flags []string `json:"flags,omitempty"`
+	Ping  int      `json:"ping"` // round trip in milliseconds, 0 until measured
+}
+
+// Data of the room response (create)
+type Room struct {
+	ID       string       `json:"id"`
+	Name     string       `json:"name"`
+	Public   bool         `json:"public"`
+	Password bool         `json:"password"` // join needs a password
+	Queue    bool         `json:"queue"`    // joins to the full room wait in line
+	Status   RoomStatus   `json:"status"`
+	Mode     string       `json:"mode"`
+	Map      string       `json:"map"`
+	Settings RoomSettings `json:"settings"`
+	Players  []PlayerView `json:"players"`
+	Foods    []Food       `json:"foods"`
+}
+
+// One public room of list_rooms and GET /api/rooms
+type RoomListing struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Mode     string `json:"mode"`
+	Map      string `json:"map"`
+	Password bool   `json:"password"` // join needs a password
+	Players  int    `json:"players"`
+	Capacity int    `json:"capacity"`
+	Queued   int    `json:"queued"` // players waiting for a free slot
+	Status   string `json:"status"`
+}
+
+// Data of the rooms response (list_rooms), also the body of GET /api/rooms
+type RoomList struct {
+	Rooms []RoomListing `json:"rooms"`
+}
+
+// Data of broadcast_room, a full snapshot of the board
+type RoomSnapshot struct {
+	Tick   uint64       `json:"tick"`
+	Snakes []PlayerView `json:"snakes"`
+	Foods  []Food       `json:"foods"`
+}
+
+// Data of server_shutdown, sent every second while the server drains. Running
+// matches may go on until Deadline (unix milliseconds), then every socket is
+// closed with 1001 (going away).
+type ServerShutdown struct {
+	Reason      string `json:"reason"`
+	Deadline    int64  `json:"deadline"`
+	SecondsLeft int    `json:"seconds_left"`
+}
+
+// Data of server_message, a notice from the operators
+type ServerMessage struct {
+	Message string `json:"message"`
+}
+
+// Data of room_state, sent to the room whenever its state, host or lock changes
+type RoomStatus struct {
+	Room   string `json:"room"`
+	State  string `json:"state"`
+	Host   int    `json:"host"` // player id, -1 without a host
+	Locked bool   `json:"locked"`
+}
+
+// Data of room_countdown, sent every second while the room is starting.
+// StartsAt is when the snakes start moving (unix milliseconds).
+type RoomCountdown struct {
+	Room        string `json:"room"`
+	SecondsLeft int    `json:"seconds_left"`
+	StartsAt    int64  `json:"starts_at"`
+}
+
+// Data of the queued response (join to a full room) and of queue_position,
+// sent whenever the place in line changes. Position 1 is next in line. Once
+// admitted, the join gets its snake response after all.
+type QueuePosition struct {
+	Room     string `json:"room"`
+	Position int    `json:"position"`
+	Size     int    `json:"size"`
+}
+
+// Data of room_closed (the room is gone) and room_kicked (the host sent the
+// player away), either way the player is back in the menu
+type RoomClosed struct {
+	Room   string `json:"room"`
+	Reason string `json:"reason"`
+}
+
+// Body of GET /api/info
+type ServerInfo struct {
+	Version            string `json:"version"`
+	Commit             string `json:"commit"`
+	ProtocolVersion    int    `json:"protocol_version"`
+	MinProtocolVersion int    `json:"min_protocol_version"`
+	UptimeSeconds      int64  `json:"uptime_seconds"`
+	TickMillis         int    `json:"tick_ms"`
+	Rooms              int    `json:"rooms"`
+	Players            int    `json:"players"`           // known, connected or waiting for reconnect
+	PlayersConnected   int    `json:"players_connected"` // with an open socket
+	Draining           bool   `json:"draining"`
+}
+
+// Changes of one snake between two ticks
+type SnakeDelta struct {
+	ID      int       `json:"id"`
+	Head    []Vector2 `json:"head,omitempty"`
+	Tail    int       `json:"tail,omitempty"`
+	BodyLen *int      `json:"body_len,omitempty"`
+	Dir     *int      `json:"dir,omitempty"`
+	Dead    *bool     `json:"dead,omitempty"`
+	Ping    *int      `json:"ping,omitempty"`
+	Flags   *[]string `json:"flags,omitempty"`
+}
+
+// Data of broadcast_delta, changes from tick Base to tick Tick
+type RoomDelta struct {
+	Tick         uint64       `json:"tick"`
+	Base         uint64       `json:"base"`
+	Snakes       []SnakeDelta `json:"snakes"`
+	Added        []PlayerView `json:"added,omitempty"`
+	Removed      []int        `json:"removed,omitempty"`
+	FoodsAdded   []Food       `json:"foods_added,omitempty"`
+	FoodsRemoved []Food       `json:"foods_removed,omitempty"`
+}
@@ -0,0 +1,59 @@
+package protocol
+
+//go:generate go run ../cmd/protogen -ts ../frontend/snake-frontend/src/api/protocol.ts -schema schema.json
+
+// Types exported by cmd/protogen, in output order
+var Types = []any{
+	Envelope{},
+	Response{},
+	Event{},
+	ConnectRequest{},
+	ReconnectRequest{},
+	CreateRequest{},
+	JoinRequest{},
+	ReadyRequest{},
+	KickRequest{},
+	LockRequest{},
+	TransferHostRequest{},
+	SettingsRequest{},
+	InputRequest{},
+	PlayerInfo{},
+	Resume{},
+	RoomSettings{},
+	Vector2{},
+	Food{},
+	Snake{},
+	PlayerView{},
+	Room{},
+	RoomListing{},
+	RoomList{},
+	RoomSnapshot{},
+	ServerShutdown{},
+	ServerMessage{},
+	RoomStatus{},
+	RoomCountdown{},
+	QueuePosition{},
+	RoomClosed{},
+	ServerInfo{},
+	SnakeDelta{},
+	RoomDelta{},
+	Fail{},
+}
+
+// String enums exported by cmd/protogen
+var Enums = map[string][]string{
+	"RequestType": {
+		TypeConnect, TypeReconnect, TypeCreate, TypeJoin, TypeDisconnect, TypeInput, TypeResync, TypeListRooms, TypeReady,
+		TypeStart, TypePause, TypeResume, TypeKick, TypeLock, TypeSettings, TypeTransferHost,
+	},
+	"ResponseType": {TypePlayer, TypeRoom, TypeSnake, TypeRooms, TypeQueued, TypeOk, TypeFail},
+	"EventType":    {EventRoom, EventDelta, EventSnakeDead, EventShutdown, EventMessage, EventSettings, EventClosed, EventQueue, EventState, EventKicked, EventCountdown},
+	"PlayerFlag":   {FlagDisconnected, FlagHost, FlagReady},
+	"RoomMode":     {ModeClassic},
+	"RoomMap":      {MapOpen},
+	"RoomState":    {RoomLobby, RoomStarting, RoomPlaying, RoomPaused},
+	"ErrorCode": {
+		ErrBadPayload, ErrUnknownType, ErrUnsupportedVersion, ErrNotConnected, ErrAlreadyConnected, ErrReconnectFailed,
+		ErrAlreadyInRoom, ErrNotInRoom, ErrRoomNotFound, ErrWrongPassword, ErrRoomFull, ErrRoomLocked, ErrKicked, ErrNotHost, ErrWrongState, ErrRateLimited, ErrServerFull, ErrShuttingDown, ErrInternal,
+	},
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.TrustedProxies = []string{"10.0.0.0/8", "::1"}
+	if err := cfg.validate(); err != nil {
+		t.Fatal(err)
+	}
+	s := newServer(cfg)
+
+	for _, tc := range []struct {
+		remote, forwarded, want string
+	}{
+		{"203.0.113.7:4000", "", "203.0.113.7"},
+		// only a trusted proxy may name the client
+		{"203.0.113.7:4000", "198.51.100.1", "203.0.113.7"},
+		{"10.1.2.3:4000", "198.51.100.1", "198.51.100.1"},
+		{"[::1]:4000", "198.51.100.1", "198.51.100.1"},
+		// the client can prepend anything, the rightmost untrusted hop wins
+		{"10.1.2.3:4000", "1.2.3.4, 198.51.100.1, 10.9.9.9", "198.51.100.1"},
+		{"10.1.2.3:4000", "garbage, 198.51.100.1", "198.51.100.1"},
+		{"10.1.2.3:4000", "", "10.1.2.3"},
+		{"10.1.2.3:4000", "10.4.4.4", "10.4.4.4"},
+	} {
+		r := httptest.NewRequest("GET", "/ws", nil)
+		r.RemoteAddr = tc.remote
+		if tc.forwarded != "" {
+			r.Header.Set("X-Forwarded-For", tc.forwarded)
+		}
+		if got := s.clientIP(r); got != tc.want {
+			t.Errorf("%s via %q: got %s, want %s", tc.remote, tc.forwarded, got, tc.want)
+		}
+	}
+
+	cfg.TrustedProxies = []string{"proxy.local"}
+	if cfg.validate() == nil {
+		t.Error("hostname accepted as trusted proxy")
+	}
+}
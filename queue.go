@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/gorilla/websocket"
+
+	"cacing/protocol"
+)
+
+// A join waiting in the queue of a full room, answered once the player gets in
+type queuedJoin struct {
+	Player   *Player
+	Request  protocol.Envelope // type and request_id of the join, for the late reply
+	MsgType  int
+	Notified int // last position the player was told
+}
+
+// No free slot for another player (call under lock)
+func (r *Room) full() bool {
+	return len(r.Players) >= r.Settings.Capacity
+}
+
+// Put a player at the end of the queue, false when the queue is full too (call under lock)
+func (r *Room) enqueue(p *Player, req protocol.Envelope, msgType int) (protocol.QueuePosition, bool) {
+	if len(r.Queue) >= MAX_ROOM_QUEUE {
+		return protocol.QueuePosition{}, false
+	}
+	r.Queue = append(r.Queue, queuedJoin{Player: p, Request: protocol.Envelope{Type: req.Type, RequestID: req.RequestID}, MsgType: msgType, Notified: len(r.Queue) + 1})
+	p.Queued = r
+	return protocol.QueuePosition{Room: r.UniqeID, Position: len(r.Queue), Size: len(r.Queue)}, true
+}
+
+// Take a player out of the queue it waits in, the ones behind it hear about
+// their new position with the next tick of the room (call under lock)
+func leaveQueue(p *Player) bool {
+	room := p.Queued
+	if room == nil {
+		return false
+	}
+	p.Queued = nil
+	for i, q := range room.Queue {
+		if q.Player == p {
+			room.Queue = append(room.Queue[:i], room.Queue[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Let queued players in while the room has free slots, they get the snake
+// response to their join, the rest of the line gets queue_position when
+// their place changed (call under lock)
+func (s *Server) admitQueued(room *Room) []writeJob {
+	var jobs []writeJob
+	for len(room.Queue) > 0 && !room.full() && !room.Locked {
+		q := room.Queue[0]
+		room.Queue = room.Queue[1:]
+		q.Player.Queued = nil
+		snake := addToRoom(room, q.Player)
+		gameLog.Info("joined room from the queue", "player", q.Player.ID, "room", room.UniqeID, "players", len(room.Players))
+		if q.Player.Socket == nil {
+			continue
+		}
+		msg, _ := json.Marshal(protocol.Response{Response: q.Request.Type, RequestID: q.Request.RequestID, Type: protocol.TypeSnake, Data: wireSnake(snake)})
+		jobs = append(jobs, writeJob{conn: q.Player.Socket, msgType: q.MsgType, msg: msg, kind: protocol.TypeSnake})
+		msg, _ = json.Marshal(protocol.Event{Type: protocol.EventState, Data: roomStatus(room)})
+		jobs = append(jobs, writeJob{conn: q.Player.Socket, msgType: websocket.TextMessage, msg: msg, kind: protocol.EventState})
+		msg, _ = json.Marshal(protocol.Event{Type: protocol.EventSettings, Data: wireSettings(room.Settings)})
+		jobs = append(jobs, writeJob{conn: q.Player.Socket, msgType: websocket.TextMessage, msg: msg, kind: protocol.EventSettings})
+	}
+	for i := range room.Queue {
+		q := &room.Queue[i]
+		if q.Notified == i+1 || q.Player.Socket == nil {
+			continue
+		}
+		q.Notified = i + 1
+		msg, _ := json.Marshal(protocol.Event{Type: protocol.EventQueue, Data: protocol.QueuePosition{Room: room.UniqeID, Position: i + 1, Size: len(room.Queue)}})
+		jobs = append(jobs, writeJob{conn: q.Player.Socket, msgType: websocket.TextMessage, msg: msg, kind: protocol.EventQueue})
+	}
+	return jobs
+}
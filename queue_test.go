@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"cacing/protocol"
+)
+
+func TestJoinQueue(t *testing.T) {
+	_, url := newTestServer(t)
+	data := func(resp protocol.Response, v any) {
+		t.Helper()
+		if err := json.Unmarshal(resp.Data.(json.RawMessage), v); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	host := dialClient(t, url, "", protocol.ConnectRequest{Name: "host"})
+	host.send(t, protocol.TypeCreate, protocol.CreateRequest{Capacity: 1, Queue: true})
+	var room protocol.Room
+	data(host.reply(t, protocol.TypeCreate), &room)
+
+	first := dialClient(t, url, "", protocol.ConnectRequest{Name: "first"})
+	second := dialClient(t, url, "", protocol.ConnectRequest{Name: "second"})
+	for i, c := range []*testClient{first, second} {
+		c.send(t, protocol.TypeJoin, protocol.JoinRequest{Room: room.ID})
+		resp := c.reply(t, protocol.TypeJoin)
+		var pos protocol.QueuePosition
+		data(resp, &pos)
+		if resp.Type != protocol.TypeQueued || pos.Position != i+1 {
+			t.Fatalf("join %d: %s %s", i, resp.Type, resp.Data)
+		}
+	}
+
+	// the host leaves, first in line takes the slot and second moves up
+	host.send(t, protocol.TypeDisconnect, nil)
+	if resp := first.reply(t, protocol.TypeJoin); resp.Type != protocol.TypeSnake {
+		t.Fatalf("first not admitted: %s %s", resp.Type, resp.Data)
+	}
+	for {
+		var event struct {
+			Type string                 `json:"type"`
+			Data protocol.QueuePosition `json:"data"`
+		}
+		json.Unmarshal(second.read(t), &event)
+		if event.Type == protocol.EventQueue {
+			if event.Data.Position != 1 {
+				t.Fatalf("second still at %d", event.Data.Position)
+			}
+			break
+		}
+	}
+
+	// without a queue a full room says so
+	solo := dialClient(t, url, "", protocol.ConnectRequest{Name: "solo"})
+	solo.send(t, protocol.TypeCreate, protocol.CreateRequest{Capacity: 1})
+	data(solo.reply(t, protocol.TypeCreate), &room)
+	host.send(t, protocol.TypeJoin, protocol.JoinRequest{Room: room.ID})
+	var fail protocol.Fail
+	data(host.reply(t, protocol.TypeJoin), &fail)
+	if fail.Code != protocol.ErrRoomFull {
+		t.Fatalf("join to a full room: %+v", fail)
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"crypto/rand"
+	"time"
+)
+
+// Hard caps of the registry, connect and create are refused past these
+const MAX_PLAYERS = 1000
+const MAX_ROOMS = 200
+
+// Room codes players type to join, from crypto/rand so they can't be predicted
+const ROOM_CODE_ALPHABET = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+const ROOM_CODE_LEN = 5
+
+// How often cleanUpService logs what it evicted
+const EVICTION_REPORT_INTERVAL = 5 * time.Minute
+
+// Register a new player, false when the registry is full (call under lock).
+// A full registry makes room by forgetting the disconnected player that has
+// been gone the longest, so sockets that connect and drop can't lock everyone
+// out until PLAYER_TIMEOUT.
+func (s *Server) addPlayer(p *Player) bool {
+	if len(s.Players) >= s.MaxPlayers {
+		var oldest *Player
+		for _, q := range s.Players {
+			if q.Socket == nil && (oldest == nil || q.LastActive.Before(oldest.LastActive)) {
+				oldest = q
+			}
+		}
+		if oldest == nil {
+			return false
+		}
+		cleanupLog.Info("registry full, evicted the longest disconnected player", "player", oldest.ID, "away", time.Since(oldest.LastActive).Round(time.Second))
+		s.evictPlayer(oldest)
+	}
+	s.Players[p.ID] = p
+	return true
+}
+
+// Register a new room under a fresh code, false when there are too many rooms (call under lock)
+func (s *Server) addRoom(r *Room) bool {
+	if len(s.Rooms) >= s.MaxRooms {
+		return false
+	}
+	for {
+		r.UniqeID = roomCode()
+		if _, taken := s.Rooms[r.UniqeID]; !taken {
+			break
+		}
+	}
+	s.Rooms[r.UniqeID] = r
+	return true
+}
+
+// Forget a room, returns its spectator streams for the caller to close
+// once the lock is released (call under lock)
+func (s *Server) removeRoom(room *Room) []*Conn {
+	delete(s.Rooms, room.UniqeID)
+	for _, q := range room.Queue {
+		q.Player.Queued = nil
+	}
+	room.Queue = nil
+	spectators := make([]*Conn, 0, len(room.Spectators))
+	for c := range room.Spectators {
+		spectators = append(spectators, c)
+	}
+	room.Spectators = nil
+	return spectators
+}
+
+// Random room code, bytes past the last whole multiple of the alphabet are
+// dropped so every character is equally likely
+func roomCode() string {
+	code := make([]byte, 0, ROOM_CODE_LEN)
+	limit := 256 - 256%len(ROOM_CODE_ALPHABET)
+	buf := make([]byte, ROOM_CODE_LEN*2)
+	for len(code) < ROOM_CODE_LEN {
+		rand.Read(buf)
+		for _, b := range buf {
+			if int(b) < limit && len(code) < ROOM_CODE_LEN {
+				code = append(code, ROOM_CODE_ALPHABET[int(b)%len(ROOM_CODE_ALPHABET)])
+			}
+		}
+	}
+	return string(code)
+}
+
+// Remove a player from its room and forget it, its session can't reconnect anymore (call under lock)
+func (s *Server) evictPlayer(p *Player) {
+	leaveQueue(p)
+	if p.Room != nil {
+		removePlayer(p.Room, p)
+		p.Room = nil
+	}
+	p.Snake = nil
+	delete(s.Players, p.ID)
+}
+
+// Put a player in a room with a fresh snake (call under lock)
+func addToRoom(room *Room, p *Player) *Snake {
+	p.Snake = newSnake(room.Settings)
+	p.Room = room
+	p.Ready = false
+	p.Sync.Resync = true
+	room.Players = append(room.Players, p)
+	return p.Snake
+}
+
+// Remove a player from the room's player list, false if it wasn't there (call under lock)
+func removePlayer(room *Room, p *Player) bool {
+	for i := range room.Players {
+		if room.Players[i].ID == p.ID {
+			room.Players = append(room.Players[:i], room.Players[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"cacing/protocol"
+)
+
+func TestPlayerCapEvictsDisconnected(t *testing.T) {
+	s, url := newTestServer(t)
+	s.Lock.Lock()
+	s.MaxPlayers = 2
+	s.Lock.Unlock()
+
+	gone := dialClient(t, url, "", protocol.ConnectRequest{Name: "gone"})
+	stays := dialClient(t, url, "", protocol.ConnectRequest{Name: "stays"})
+	full := dialSocket(t, url, "")
+	full.send(t, protocol.TypeConnect, protocol.ConnectRequest{Name: "full"})
+	if got := failCode(full.reply(t, protocol.TypeConnect)); got != protocol.ErrServerFull {
+		t.Fatalf("third player: got %q", got)
+	}
+
+	// a dropped socket frees its slot for the next player
+	gone.conn.Close()
+	for deadline := time.Now().Add(2 * time.Second); ; {
+		s.Lock.Lock()
+		detached := s.Players[gone.id].Socket == nil
+		s.Lock.Unlock()
+		if detached {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("socket never detached")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	full.send(t, protocol.TypeConnect, protocol.ConnectRequest{Name: "full"})
+	if resp := full.reply(t, protocol.TypeConnect); resp.Type != protocol.TypePlayer {
+		t.Fatalf("after a drop: %s %s", resp.Type, resp.Data)
+	}
+
+	s.Lock.Lock()
+	defer s.Lock.Unlock()
+	if s.Players[gone.id] != nil || s.Players[stays.id] == nil || len(s.Players) != 2 {
+		t.Errorf("wrong player evicted: %d players, gone %v", len(s.Players), s.Players[gone.id] != nil)
+	}
+}
+
+func TestCleanUpEvictsTimedOut(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.CleanupInterval = Duration(10 * time.Millisecond)
+	s := newServer(cfg)
+	room := &Room{UniqeID: "ROOM1", Settings: s.RoomDefaults}
+	timedOut := &Player{ID: 1, LastActive: time.Now().Add(-2 * s.PlayerTimeout)}
+	away := &Player{ID: 2, LastActive: time.Now()}
+	// the room is not registered, so the zero Conn never gets a frame
+	connected := &Player{ID: 3, Socket: &Conn{}, LastActive: time.Now().Add(-2 * s.PlayerTimeout)}
+	for _, p := range []*Player{timedOut, away, connected} {
+		s.Players[p.ID] = p
+		addToRoom(room, p)
+	}
+	s.start()
+	defer s.stop(context.Background())
+
+	for deadline := time.Now().Add(2 * time.Second); ; {
+		s.Lock.Lock()
+		evicted := s.Players[timedOut.ID] == nil
+		s.Lock.Unlock()
+		if evicted {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("timed out player never evicted")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	s.Lock.Lock()
+	defer s.Lock.Unlock()
+	if s.Players[away.ID] == nil || s.Players[connected.ID] == nil {
+		t.Error("evicted a player that was still within its timeout or connected")
+	}
+	if timedOut.Room != nil || timedOut.Snake != nil || len(room.Players) != 2 {
+		t.Errorf("evicted player still in the room: %d players", len(room.Players))
+	}
+}
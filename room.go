@@ -1,8 +1,122 @@
 package main
 
+import (
+	"fmt"
+	"time"
+
+	"cacing/protocol"
+)
+
+// Bounds of room settings, for the config and for changes at runtime
+const MIN_ARENA_SIZE = 4
+const MAX_ARENA_SIZE = 1024
+const MIN_TICK_INTERVAL = 10 * time.Millisecond
+const MAX_TICK_INTERVAL = 2 * time.Second
+const MIN_ROOM_CAPACITY = 1
+const MAX_ROOM_CAPACITY = 64
+const MIN_READY_QUORUM = 1
+const MAX_READY_QUORUM = 100
+
+// Players of a room when neither the config nor create asks otherwise
+const ROOM_CAPACITY = 8
+
+// Percent of the connected players that must be ready to start, all by default
+const READY_QUORUM = 100
+
+// Longest waiting queue of a room, joins past it get ROOM_FULL
+const MAX_ROOM_QUEUE = 32
+
 // Room struct
 type Room struct {
-	UniqeID string    `json:"id"`
-	Players []*Player `json:"players"`
-	Foods   []Food    `json:"foods"`
+	UniqeID    string         `json:"id"`
+	Name       string         `json:"name"`
+	Public     bool           `json:"public"` // listed by list_rooms, else only joinable by code
+	Password   *roomPassword  `json:"-"`      // nil when anyone with the code may join
+	Mode       string         `json:"mode"`
+	Map        string         `json:"map"`
+	State      string         `json:"state"` // protocol.RoomLobby, RoomPlaying or RoomPaused
+	Host       *Player        `json:"-"`     // may start, pause and change the room
+	Locked     bool           `json:"-"`     // refuses every join
+	Kicked     map[int]bool   `json:"-"`     // players the host sent away, nil until the first kick
+	StartAt    time.Time      `json:"-"`     // end of the countdown while starting
+	StartLeft  int            `json:"-"`     // seconds of the countdown last announced
+	Forced     bool           `json:"-"`     // the host started, readiness doesn't matter
+	Players    []*Player      `json:"players"`
+	Foods      []Food         `json:"foods"`
+	Tick       uint64         `json:"-"`
+	TickAt     time.Time      `json:"-"`
+	NextTick   time.Time      `json:"-"` // when updateGame runs the next tick
+	TickCost   time.Duration  `json:"-"` // time the last tick took to simulate and encode
+	Frame      *roomFrame     `json:"-"`
+	Settings   RoomSettings   `json:"-"`
+	Spectators map[*Conn]bool `json:"-"` // read-only admin streams, nil until the first one
+	QueueOn    bool           `json:"-"` // full room queues joins instead of refusing them
+	Queue      []queuedJoin   `json:"-"` // players waiting for a free slot, first in line first
 };
+
+// Settings of a room, sent to clients on create and on reconnect
+type RoomSettings struct {
+	ArenaWidth   int
+	ArenaHeight  int
+	TickInterval time.Duration
+	Capacity     int
+	ReadyQuorum  int
+}
+
+// Error describing the first setting out of bounds
+func (rs RoomSettings) validate() error {
+	switch {
+	case rs.ArenaWidth < MIN_ARENA_SIZE || rs.ArenaWidth > MAX_ARENA_SIZE:
+		return fmt.Errorf("arena_width must be %d-%d, got %d", MIN_ARENA_SIZE, MAX_ARENA_SIZE, rs.ArenaWidth)
+	case rs.ArenaHeight < MIN_ARENA_SIZE || rs.ArenaHeight > MAX_ARENA_SIZE:
+		return fmt.Errorf("arena_height must be %d-%d, got %d", MIN_ARENA_SIZE, MAX_ARENA_SIZE, rs.ArenaHeight)
+	case rs.TickInterval < MIN_TICK_INTERVAL || rs.TickInterval > MAX_TICK_INTERVAL:
+		return fmt.Errorf("tick interval must be %v-%v, got %v", MIN_TICK_INTERVAL, MAX_TICK_INTERVAL, rs.TickInterval)
+	case rs.Capacity < MIN_ROOM_CAPACITY || rs.Capacity > MAX_ROOM_CAPACITY:
+		return fmt.Errorf("capacity must be %d-%d, got %d", MIN_ROOM_CAPACITY, MAX_ROOM_CAPACITY, rs.Capacity)
+	case rs.ReadyQuorum < MIN_READY_QUORUM || rs.ReadyQuorum > MAX_READY_QUORUM:
+		return fmt.Errorf("ready_quorum must be %d-%d percent, got %d", MIN_READY_QUORUM, MAX_READY_QUORUM, rs.ReadyQuorum)
+	}
+	return nil
+}
+
+// The settings with the fields set in req changed
+func (rs RoomSettings) with(req protocol.SettingsRequest) RoomSettings {
+	if req.ArenaWidth != nil {
+		rs.ArenaWidth = *req.ArenaWidth
+	}
+	if req.ArenaHeight != nil {
+		rs.ArenaHeight = *req.ArenaHeight
+	}
+	if req.TickMillis != nil {
+		rs.TickInterval = time.Duration(*req.TickMillis) * time.Millisecond
+	}
+	if req.Capacity != nil {
+		// players past a lowered capacity stay, only new joins wait or get refused
+		rs.Capacity = *req.Capacity
+	}
+	if req.ReadyQuorum != nil {
+		rs.ReadyQuorum = *req.ReadyQuorum
+	}
+	return rs
+}
+
+// Switch a running room to new settings, food outside a smaller arena
+// disappears and snakes sticking out of it respawn inside (call under lock)
+func (r *Room) applySettings(rs RoomSettings) {
+	r.Settings = rs
+	foods := r.Foods[:0]
+	for _, f := range r.Foods {
+		if f.Position.X < rs.ArenaWidth && f.Position.Y < rs.ArenaHeight {
+			foods = append(foods, f)
+		}
+	}
+	r.Foods = foods
+	for _, p := range r.Players {
+		if p.Snake != nil && !p.Snake.inside(rs.ArenaWidth, rs.ArenaHeight) {
+			p.Snake.respawn(rs)
+		}
+	}
+	// the next tick comes at the new pace
+	r.NextTick = r.TickAt.Add(rs.TickInterval)
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"cacing/protocol"
+)
+
+// Longest room name in characters
+const MAX_ROOM_NAME = 32
+
+// Modes and maps a room can be created with, the first one is the default
+var ROOM_MODES = []string{protocol.ModeClassic}
+var ROOM_MAPS = []string{protocol.MapOpen}
+
+// Fill in the defaults of a create request and check what is left, the error
+// is meant for the player
+func createOptions(req *protocol.CreateRequest, owner string) error {
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		req.Name = owner + "'s room"
+	}
+	if len(req.Password) > MAX_ROOM_PASSWORD {
+		return fmt.Errorf("Room password is longer than %d bytes.", MAX_ROOM_PASSWORD)
+	}
+	if utf8.RuneCountInString(req.Name) > MAX_ROOM_NAME {
+		return fmt.Errorf("Room name is longer than %d characters.", MAX_ROOM_NAME)
+	}
+	if req.Mode == "" {
+		req.Mode = ROOM_MODES[0]
+	}
+	if !slices.Contains(ROOM_MODES, req.Mode) {
+		return fmt.Errorf("Unknown mode %q, pick one of %s.", req.Mode, strings.Join(ROOM_MODES, ", "))
+	}
+	if req.Map == "" {
+		req.Map = ROOM_MAPS[0]
+	}
+	if !slices.Contains(ROOM_MAPS, req.Map) {
+		return fmt.Errorf("Unknown map %q, pick one of %s.", req.Map, strings.Join(ROOM_MAPS, ", "))
+	}
+	return nil
+}
+
+// Public rooms, fullest first so new players end up where the action is
+// (call under lock)
+func (s *Server) publicRooms() protocol.RoomList {
+	list := protocol.RoomList{Rooms: []protocol.RoomListing{}}
+	for _, r := range s.Rooms {
+		if !r.Public {
+			continue
+		}
+		list.Rooms = append(list.Rooms, protocol.RoomListing{
+			ID:       r.UniqeID,
+			Name:     r.Name,
+			Mode:     r.Mode,
+			Map:      r.Map,
+			Password: r.Password != nil,
+			Players:  len(r.Players),
+			Capacity: r.Settings.Capacity,
+			Queued:   len(r.Queue),
+			Status:   r.State,
+		})
+	}
+	slices.SortFunc(list.Rooms, func(a, b protocol.RoomListing) int {
+		return cmp.Or(cmp.Compare(b.Players, a.Players), cmp.Compare(a.ID, b.ID))
+	})
+	return list
+}
+
+// GET /api/rooms, the same list as list_rooms for browsers and lobby pages
+func (s *Server) handleRooms(w http.ResponseWriter, r *http.Request) {
+	s.Lock.Lock()
+	list := s.publicRooms()
+	s.Lock.Unlock()
+	writeJSON(w, http.StatusOK, list)
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"cacing/protocol"
+)
+
+func TestListRoomsOnlyPublic(t *testing.T) {
+	s, url := newTestServer(t)
+
+	pub := dialClient(t, url, "", protocol.ConnectRequest{Name: "pub"})
+	pub.send(t, protocol.TypeCreate, protocol.CreateRequest{Name: "open lobby", Public: true})
+	var room protocol.Room
+	json.Unmarshal(pub.reply(t, protocol.TypeCreate).Data.(json.RawMessage), &room)
+	if room.Mode != protocol.ModeClassic || room.Map != protocol.MapOpen {
+		t.Fatalf("defaults not applied: %+v", room)
+	}
+
+	priv := dialClient(t, url, "", protocol.ConnectRequest{Name: "priv"})
+	priv.send(t, protocol.TypeCreate, nil)
+	priv.reply(t, protocol.TypeCreate)
+
+	bad := dialClient(t, url, "", protocol.ConnectRequest{Name: "bad"})
+	bad.send(t, protocol.TypeCreate, protocol.CreateRequest{Mode: "battle royale"})
+	if resp := bad.reply(t, protocol.TypeCreate); resp.Type != protocol.TypeFail {
+		t.Fatalf("unknown mode accepted: %s", resp.Data)
+	}
+
+	bad.send(t, protocol.TypeListRooms, nil)
+	var list protocol.RoomList
+	json.Unmarshal(bad.reply(t, protocol.TypeListRooms).Data.(json.RawMessage), &list)
+	want := protocol.RoomListing{ID: room.ID, Name: "open lobby", Mode: protocol.ModeClassic, Map: protocol.MapOpen, Players: 1, Capacity: ROOM_CAPACITY, Status: protocol.RoomLobby}
+	if len(list.Rooms) != 1 || list.Rooms[0] != want {
+		t.Fatalf("list_rooms = %+v, want only %+v", list.Rooms, want)
+	}
+
+	rec := httptest.NewRecorder()
+	s.handleRooms(rec, httptest.NewRequest("GET", "/api/rooms", nil))
+	var body protocol.RoomList
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || len(body.Rooms) != 1 || body.Rooms[0].ID != room.ID {
+		t.Fatalf("GET /api/rooms = %s", rec.Body)
+	}
+}
@@ -1,265 +1,536 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"log"
 	"math/rand"
 	"net/http"
-	"strconv"
+	"net/netip"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
+
+	"cacing/protocol"
 )
 
 // Server struct (some arena game and player timeout as const)
 const ARENA_SIZEX = 32
 const ARENA_SIZEY = 32
 const PLAYER_TIMEOUT = 5 * time.Minute
+const TICK_INTERVAL = 150 * time.Millisecond
+const CLEANUP_INTERVAL = 10 * time.Second
+
+// How long the snake of a disconnected player stays frozen waiting for a reconnect
+const DISCONNECT_GRACE = 30 * time.Second
 
 // some server struct
 type Server struct {
-	PlayerConn []*Player
-	Room       []Room
-	Upgrade    websocket.Upgrader
-	Counter    int
-	Lock       sync.Mutex
+	Players         map[int]*Player         // every known player, connected or waiting for reconnect
+	Sockets         map[*Conn]bool          // every open websocket, with or without a player
+	Bans            map[string]ban          // remote addresses refused by an admin
+	JoinFails       map[string]*joinLimiter // failed joins by client address
+	TrustedProxies  []netip.Prefix          // reverse proxies allowed to set X-Forwarded-For
+	Rooms           map[string]*Room        // rooms by id
+	MaxPlayers      int
+	MaxRooms        int
+	Upgrade         websocket.Upgrader
+	MaxMessageSize  int64
+	Counter         int
+	Lock            sync.Mutex
+	PingInterval    time.Duration
+	PongWait        time.Duration
+	InputGrace      time.Duration
+	DisconnectGrace time.Duration // snakes of disconnected players freeze this long, then die
+	SessionTTL      time.Duration
+	TickInterval    time.Duration
+	PlayerTimeout   time.Duration
+	CleanupInterval time.Duration
+	EvictionReport  time.Duration
+	RoomDefaults    RoomSettings  // settings of new rooms
+	Countdown       time.Duration // from the lobby to the match
+	Draining        bool          // shutting down, no new rooms or joins
+	ShutdownHooks   []func(ctx context.Context) error
+	Metrics         *Metrics
+	Started         time.Time
+	LastLoop        atomic.Int64  // unix nanos of the last game loop iteration, for /healthz
+	quit            chan struct{} // closed to stop the game loops
+	loops           sync.WaitGroup
+}
+
+// Build a server from a validated config
+func newServer(cfg Config) *Server {
+	up := cfg.upgrader()
+	proxies, _ := parseTrustedProxies(cfg.TrustedProxies)
+	return &Server{
+		Upgrade:         newUpgrader(up),
+		MaxMessageSize:  up.MaxMessageSize,
+		Counter:         0,
+		Players:         make(map[int]*Player),
+		Sockets:         make(map[*Conn]bool),
+		Bans:            make(map[string]ban),
+		JoinFails:       make(map[string]*joinLimiter),
+		TrustedProxies:  proxies,
+		Rooms:           make(map[string]*Room),
+		MaxPlayers:      cfg.MaxPlayers,
+		MaxRooms:        cfg.MaxRooms,
+		PingInterval:    time.Duration(cfg.PingInterval),
+		PongWait:        time.Duration(cfg.PongWait),
+		InputGrace:      time.Duration(cfg.InputGrace),
+		DisconnectGrace: time.Duration(cfg.DisconnectGrace),
+		SessionTTL:      time.Duration(cfg.SessionTTL),
+		TickInterval:    time.Duration(cfg.TickInterval),
+		PlayerTimeout:   time.Duration(cfg.PlayerTimeout),
+		CleanupInterval: time.Duration(cfg.CleanupInterval),
+		EvictionReport:  time.Duration(cfg.EvictionReportInterval),
+		RoomDefaults: RoomSettings{
+			ArenaWidth:   cfg.ArenaWidth,
+			ArenaHeight:  cfg.ArenaHeight,
+			TickInterval: time.Duration(cfg.TickInterval),
+			Capacity:     cfg.RoomCapacity,
+			ReadyQuorum:  cfg.ReadyQuorum,
+		},
+		Countdown: time.Duration(cfg.Countdown),
+		Metrics:   newMetrics(),
+		Started:   time.Now(),
+		quit:      make(chan struct{}),
+	}
 }
 
 // small helper type for deferred writes (so we don't write under lock)
 type writeJob struct {
-	conn    *websocket.Conn
+	conn    *Conn
 	msgType int
 	msg     []byte
+	kind    string  // protocol type of msg, for metrics
+	player  *Player // set for room frames, so a failed write forces a resync
 }
 
 // Handling websocket connections
 func (s *Server) handleConnection(w http.ResponseWriter, r *http.Request) {
-	conn, err := s.Upgrade.Upgrade(w, r, nil)
+	logger := wsLog.With("remote", r.RemoteAddr)
+	addr := s.clientIP(r)
+	s.Lock.Lock()
+	b, isBanned := s.banned(addr)
+	s.Lock.Unlock()
+	if isBanned {
+		logger.Info("banned address refused", "addr", addr, "until", b.Until)
+		http.Error(w, "banned: "+b.Reason, http.StatusForbidden)
+		return
+	}
+
+	ws, err := s.Upgrade.Upgrade(w, r, nil)
 	if err != nil {
-		log.Println("Upgrade failed:", err)
+		logger.Warn("upgrade failed", "err", err)
 		return
 	}
+	conn := newConn(ws, s.Metrics)
 	defer conn.Close()
+	s.Lock.Lock()
+	s.Sockets[conn] = true
+	s.Lock.Unlock()
+	defer func() {
+		s.Lock.Lock()
+		delete(s.Sockets, conn)
+		s.Lock.Unlock()
+	}()
+	conn.SetReadLimit(s.MaxMessageSize)
 
-	timeout := 240 * time.Second
+	timeout := s.PongWait
 	conn.SetReadDeadline(time.Now().Add(timeout))
 
 	var pPtr *Player = nil
+	joins := joinLimiter{limit: JOIN_MAX_FAILS} // failed joins of this connection
+
+	// every pong proves the client is alive and gives us its round trip time
+	conn.SetPongHandler(func(payload string) error {
+		conn.SetReadDeadline(time.Now().Add(timeout))
+		if rtt, ok := conn.pong(payload); ok && pPtr != nil {
+			s.Lock.Lock()
+			if pPtr.Socket == conn {
+				pPtr.RTT = rtt
+			}
+			s.Lock.Unlock()
+		}
+		return nil
+	})
+
+	stopPing := make(chan struct{})
+	defer close(stopPing)
+	go s.pingLoop(conn, stopPing)
 
 	// Read messages loop
 	for {
 		messageType, msgBytes, err := conn.ReadMessage()
 		if err != nil {
-			if pPtr != nil {
-				s.Lock.Lock()
-				pPtr.Socket = nil
-				pPtr.LastActive = time.Now()
-				s.Lock.Unlock()
-			}
-			log.Println("ReadMessage error / client disconnected:", err)
+			logger.Info("connection closed", "err", err)
 			break
 		}
 		conn.SetReadDeadline(time.Now().Add(timeout))
 
 		// Parse incoming message
-		var incoming Message
-		if err := json.Unmarshal(msgBytes, &incoming); err != nil {
-			log.Println("Invalid JSON message:", err)
-			sendFail(conn, messageType, "", "Invalid JSON")
+		var incoming protocol.Envelope
+		if messageType == websocket.BinaryMessage {
+			// binary frames only carry inputs, replies are still JSON text
+			messageType = websocket.TextMessage
+			incoming, err = decodeBinaryMessage(msgBytes)
+			if err != nil {
+				logger.Debug("invalid binary message", "err", err)
+				sendFail(conn, messageType, incoming, protocol.ErrBadPayload, "Invalid binary message")
+				continue
+			}
+		} else if err := json.Unmarshal(msgBytes, &incoming); err != nil {
+			logger.Debug("invalid JSON message", "err", err)
+			sendFail(conn, messageType, incoming, protocol.ErrBadPayload, "Invalid JSON")
 			continue
 		}
 
+		s.Metrics.messageIn(incoming.Type)
+		mlog := logger.With("msg_type", incoming.Type)
+		mlog.Debug("message", "request_id", incoming.RequestID)
+
 		// We'll collect any writes that must be performed after releasing locks
 		var toWrite []writeJob
 
 		// Handle different connection message types
 		switch incoming.Type {
-		case "connect":
-			var name string
-			if err := json.Unmarshal(incoming.Data, &name); err != nil {
-				var tmp struct{ Name string `json:"name"` }
-				if err2 := json.Unmarshal(incoming.Data, &tmp); err2 != nil {
-					sendFail(conn, messageType, "connect", "Failed to parse connect data")
+		case protocol.TypeConnect:
+			if pPtr != nil {
+				sendFail(conn, messageType, incoming, protocol.ErrAlreadyConnected, "This socket already has a player.")
+				continue
+			}
+			var req protocol.ConnectRequest
+			if err := json.Unmarshal(incoming.Data, &req.Name); err != nil {
+				if err2 := json.Unmarshal(incoming.Data, &req); err2 != nil {
+					sendFail(conn, messageType, incoming, protocol.ErrBadPayload, "Failed to parse connect data")
 					continue
 				}
-				name = tmp.Name
+			}
+			if req.Version == 0 {
+				req.Version = protocol.MinVersion
+			}
+			if req.Version < protocol.MinVersion || req.Version > protocol.Version {
+				sendFailDetails(conn, messageType, incoming, protocol.ErrUnsupportedVersion,
+					fmt.Sprintf("Unsupported protocol version %d, server speaks %d to %d.", req.Version, protocol.MinVersion, protocol.Version),
+					map[string]any{"min_version": protocol.MinVersion, "max_version": protocol.Version})
+				continue
 			}
 
 			s.Lock.Lock()
 			newID := s.Counter
 			s.Counter++
 			pPtr = &Player{
-				ID:      newID,
-				Name:    name,
-				Socket:  conn,
-				Room:    nil,
-				Snake:   nil,
-				UniqeID: strings.ToUpper(fmt.Sprintf("%05s", strconv.FormatInt(rand.Int63n(36*36*36*36*36), 36))),
-			}
-			s.PlayerConn = append(s.PlayerConn, pPtr)
+				ID:     newID,
+				Name:   req.Name,
+				Socket: conn,
+				Room:   nil,
+				Snake:  nil,
+				Sync:   clientSync{Delta: req.Delta},
+				RTT:    conn.RTT(),
+				Addr:   addr,
+			}
+			pPtr.rotateToken(s.SessionTTL)
+			if !s.addPlayer(pPtr) {
+				s.Lock.Unlock()
+				pPtr = nil
+				sendFail(conn, messageType, incoming, protocol.ErrServerFull, "The server is full, try again later.")
+				continue
+			}
+			pub := playerInfo(pPtr)
 			s.Lock.Unlock()
 
-			pub := PlayerPublic{ID: pPtr.ID, Name: pPtr.Name, UniqeID: pPtr.UniqeID}
-			ret := map[string]any{"response": "connect", "type": "player", "data": pub}
-			jsonBytes, _ := json.Marshal(ret)
-			_ = conn.WriteMessage(messageType, jsonBytes)
+			logger = logger.With("player", pPtr.ID)
+			logger.Info("player connected", "name", pPtr.Name, "version", req.Version, "delta", req.Delta, "subprotocol", conn.Subprotocol())
+
+			sendResponse(conn, messageType, incoming, protocol.TypePlayer, pub)
 
-		case "reconnect":
-			var rdata struct {
-				ID       int    `json:"id"`
-				UniqueID string `json:"unique_id"`
+		case protocol.TypeReconnect:
+			if pPtr != nil {
+				sendFail(conn, messageType, incoming, protocol.ErrAlreadyConnected, "This socket already has a player.")
+				continue
 			}
+			var rdata protocol.ReconnectRequest
 			if err := json.Unmarshal(incoming.Data, &rdata); err != nil {
-				sendFail(conn, messageType, "reconnect", "Failed to parse reconnect data")
+				sendFail(conn, messageType, incoming, protocol.ErrBadPayload, "Failed to parse reconnect data")
 				continue
 			}
 
 			found := false
-			var respMsg []byte
+			var pub protocol.PlayerInfo
 
 			s.Lock.Lock()
-			for _, p := range s.PlayerConn {
-				if p.ID == rdata.ID && p.UniqeID == rdata.UniqueID {
-					// close old socket if present
-					if p.Socket != nil && p.Socket != conn {
-						_ = p.Socket.Close()
+			if p := s.Players[rdata.ID]; p != nil && p.validToken(rdata.Token) {
+				// close old socket if present
+				if p.Socket != nil && p.Socket != conn {
+					_ = p.Socket.Close()
+				}
+				p.Socket = conn
+				p.RTT = conn.RTT()
+				p.Addr = addr
+				p.Sync.Resync = true
+				pPtr = p
+
+				// a token is good for one reconnect only
+				p.rotateToken(s.SessionTTL)
+				pub = playerInfo(p)
+				if p.Room != nil && p.Snake != nil {
+					// put the client back where it left: room, settings, own snake and the board
+					pub.Resume = &protocol.Resume{
+						Room:     p.Room.UniqeID,
+						Settings: wireSettings(p.Room.Settings),
+						Snake:    wireSnake(p.Snake),
+						Snapshot: roomSnapshot(p.Room),
+						Status:   roomStatus(p.Room),
 					}
-					p.Socket = conn
-					pPtr = p
-
-					pub := PlayerPublic{ID: p.ID, Name: p.Name, UniqeID: p.UniqeID}
-					ret := map[string]any{"response": "reconnect", "type": "player", "data": pub}
-					jsonBytes, _ := json.Marshal(ret)
-					respMsg = jsonBytes
-					found = true
-					break
 				}
+				found = true
 			}
 			s.Lock.Unlock()
+			if found {
+				s.Metrics.Reconnects.Add(1)
+				logger = logger.With("player", pPtr.ID)
+				mlog.Info("player reconnected", "player", pPtr.ID, "resume", pub.Resume != nil)
+			}
 
 			if !found {
-				sendFail(conn, messageType, "reconnect", "Failed to reconnect with that id and unique_id")
+				sendFail(conn, messageType, incoming, protocol.ErrReconnectFailed, "Failed to reconnect with that id and token, the session may have expired.")
 				continue
 			}
 			// write after unlocking
-			if respMsg != nil {
-				_ = conn.WriteMessage(messageType, respMsg)
-			}
+			sendResponse(conn, messageType, incoming, protocol.TypePlayer, pub)
 
-		case "create":
+		case protocol.TypeCreate:
 			if pPtr == nil {
-				sendFail(conn, messageType, "create", "Connect first to access create.")
+				sendFail(conn, messageType, incoming, protocol.ErrNotConnected, "Connect first to access create.")
+				continue
+			}
+			if pPtr.Room != nil || pPtr.Queued != nil {
+				sendFail(conn, messageType, incoming, protocol.ErrAlreadyInRoom, "Already joined another room.")
+				continue
+			}
+
+			var opts protocol.CreateRequest
+			if len(incoming.Data) > 0 {
+				if err := json.Unmarshal(incoming.Data, &opts); err != nil {
+					sendFail(conn, messageType, incoming, protocol.ErrBadPayload, "Failed to parse create data")
+					continue
+				}
+			}
+			if err := createOptions(&opts, pPtr.Name); err != nil {
+				sendFail(conn, messageType, incoming, protocol.ErrBadPayload, err.Error())
+				continue
+			}
+
+			s.Lock.Lock()
+			draining := s.Draining
+			s.Lock.Unlock()
+			if draining {
+				sendFail(conn, messageType, incoming, protocol.ErrShuttingDown, "The server is shutting down, no new rooms.")
 				continue
 			}
-			if pPtr.Room != nil {
-				// already in a room; ignore
+
+			settings := s.RoomDefaults
+			if opts.Capacity != 0 {
+				settings.Capacity = opts.Capacity
+			}
+			if err := settings.validate(); err != nil {
+				sendFail(conn, messageType, incoming, protocol.ErrBadPayload, err.Error())
 				continue
 			}
 
-			newSnake := Snake{
-				Body:      []Vector2{{X: rand.Intn(ARENA_SIZEX), Y: rand.Intn(ARENA_SIZEY)}},
-				BodyLen:   1,
-				Color:     generate_random_color(),
-				Direction: rand.Intn(4),
+			var password *roomPassword
+			if opts.Password != "" {
+				var err error
+				if password, err = hashRoomPassword(opts.Password); err != nil {
+					mlog.Error("hashing room password failed", "err", err)
+					sendFail(conn, messageType, incoming, protocol.ErrInternal, "Failed to set the room password.")
+					continue
+				}
 			}
-			pPtr.Snake = &newSnake
 
-			newRoom := Room{
-				UniqeID: strings.ToUpper(fmt.Sprintf("%05s", strconv.FormatInt(rand.Int63n(36*36*36*36*36), 36))),
-				Players: []*Player{pPtr},
-				Foods:   make([]Food, 0, 10),
+			// the code is drawn by addRoom
+			newRoom := &Room{
+				Name:     opts.Name,
+				Password: password,
+				Public:   opts.Public,
+				Mode:     opts.Mode,
+				Map:      opts.Map,
+				Players:  []*Player{pPtr},
+				Foods:    make([]Food, 0, 10),
+				Settings: settings,
+				QueueOn:  opts.Queue,
+				State:    protocol.RoomLobby,
+				Host:     pPtr,
 			}
+			pPtr.Snake = newSnake(newRoom.Settings)
 
 			// mutate server state under lock, but don't write socket messages while locked
 			s.Lock.Lock()
-			s.Room = append(s.Room, newRoom)
-			// point pPtr.Room to the newly appended room
-			pPtr.Room = &s.Room[len(s.Room)-1]
+			if !s.addRoom(newRoom) {
+				s.Lock.Unlock()
+				pPtr.Snake = nil
+				sendFail(conn, messageType, incoming, protocol.ErrServerFull, "Too many rooms on this server, try again later.")
+				continue
+			}
+			pPtr.Room = newRoom
+			pPtr.Ready = false
+			pPtr.Sync.Resync = true
 			// capture a copy of the room to send to client
-			roomToSend := s.Room[len(s.Room)-1]
+			roomToSend := wireRoom(newRoom)
+			s.Lock.Unlock()
+
+			mlog.Info("room created", "room", newRoom.UniqeID, "public", newRoom.Public, "password", password != nil, "mode", newRoom.Mode, "map", newRoom.Map)
+
+			sendResponse(conn, messageType, incoming, protocol.TypeRoom, roomToSend)
+
+		case protocol.TypeListRooms:
+			s.Lock.Lock()
+			list := s.publicRooms()
 			s.Lock.Unlock()
 
-			ret := map[string]any{"response": "create", "type": "room", "data": roomToSend}
-			jsonBytes, _ := json.Marshal(ret)
-			_ = conn.WriteMessage(messageType, jsonBytes)
+			sendResponse(conn, messageType, incoming, protocol.TypeRooms, list)
 
-		case "join":
+		case protocol.TypeStart, protocol.TypePause, protocol.TypeResume, protocol.TypeKick,
+			protocol.TypeLock, protocol.TypeSettings, protocol.TypeTransferHost:
+			s.handleHostRequest(conn, messageType, incoming, pPtr)
+
+		case protocol.TypeReady:
+			s.handleReady(conn, messageType, incoming, pPtr)
+
+		case protocol.TypeJoin:
 			if pPtr == nil {
-				sendFail(conn, messageType, "join", "Connect first to access join.")
+				sendFail(conn, messageType, incoming, protocol.ErrNotConnected, "Connect first to access join.")
 				continue
 			}
-			var room string
-			if err := json.Unmarshal(incoming.Data, &room); err != nil {
-				var tmp struct {
-					Room string `json:"room"`
-				}
-				if err2 := json.Unmarshal(incoming.Data, &tmp); err2 != nil {
-					sendFail(conn, messageType, "join", "Failed to parse join data")
+			var req protocol.JoinRequest
+			if err := json.Unmarshal(incoming.Data, &req.Room); err != nil {
+				if err2 := json.Unmarshal(incoming.Data, &req); err2 != nil {
+					sendFail(conn, messageType, incoming, protocol.ErrBadPayload, "Failed to parse join data")
 					continue
 				}
-				room = tmp.Room
 			}
+			room := strings.ToUpper(req.Room)
 
-			room = strings.ToUpper(room)
+			s.Lock.Lock()
+			if s.Draining {
+				s.Lock.Unlock()
+				sendFail(conn, messageType, incoming, protocol.ErrShuttingDown, "The server is shutting down, no new players.")
+				continue
+			}
+			// failed joins count per connection and per address, to slow down guessing codes and passwords
+			if wait := max(joins.wait(time.Now()), s.joinWait(addr, time.Now())); wait > 0 {
+				s.Lock.Unlock()
+				sendFailDetails(conn, messageType, incoming, protocol.ErrRateLimited,
+					fmt.Sprintf("Too many failed joins, try again in %ds.", int(wait.Seconds())+1),
+					map[string]any{"retry_after_ms": wait.Milliseconds()})
+				continue
+			}
+			roomPtr := s.Rooms[room]
+			var password *roomPassword
+			if roomPtr != nil {
+				password = roomPtr.Password
+			}
+			s.Lock.Unlock()
 
-			createdSnake := &Snake{
-				Body:      []Vector2{{X: rand.Intn(ARENA_SIZEX), Y: rand.Intn(ARENA_SIZEY)}},
-				BodyLen:   1,
-				Color:     generate_random_color(),
-				Direction: rand.Intn(4),
+			if roomPtr == nil {
+				joins.fail(time.Now())
+				s.Lock.Lock()
+				s.joinFailed(addr, time.Now())
+				s.Lock.Unlock()
+				sendFail(conn, messageType, incoming, protocol.ErrRoomNotFound, "There is no room with that id.")
+				continue
+			}
+			// hashing is slow on purpose, keep it outside the lock
+			if password != nil && !password.check(req.Password) {
+				joins.fail(time.Now())
+				s.Lock.Lock()
+				addrFails := s.joinFailed(addr, time.Now())
+				s.Lock.Unlock()
+				mlog.Warn("wrong room password", "room", room, "fails", joins.fails, "addr_fails", addrFails)
+				sendFail(conn, messageType, incoming, protocol.ErrWrongPassword, "Wrong room password.")
+				continue
 			}
 
-			var roomPtr *Room = nil
 			s.Lock.Lock()
-			for i := range s.Room {
-				if s.Room[i].UniqeID == room {
-					roomPtr = &s.Room[i]
-					break
-				}
+			if s.Rooms[room] != roomPtr {
+				s.Lock.Unlock()
+				sendFail(conn, messageType, incoming, protocol.ErrRoomNotFound, "The room closed in the meantime.")
+				continue
+			}
+			if roomPtr.Kicked[pPtr.ID] {
+				s.Lock.Unlock()
+				sendFail(conn, messageType, incoming, protocol.ErrKicked, "The host kicked you from this room.")
+				continue
+			}
+			if roomPtr.Locked {
+				s.Lock.Unlock()
+				sendFail(conn, messageType, incoming, protocol.ErrRoomLocked, "The host locked the room.")
+				continue
 			}
 
-			if roomPtr == nil {
+			if pPtr.Room != nil || pPtr.Queued != nil {
 				s.Lock.Unlock()
-				sendFail(conn, messageType, "join", "There is no room with that id.")
+				sendFail(conn, messageType, incoming, protocol.ErrAlreadyInRoom, "Already joined another room.")
 				continue
 			}
 
-			if pPtr.Room != nil {
+			// nobody skips the line, even when a slot just freed up
+			if roomPtr.full() || len(roomPtr.Queue) > 0 {
+				var position protocol.QueuePosition
+				queueOn, queued := roomPtr.QueueOn, false
+				if queueOn {
+					position, queued = roomPtr.enqueue(pPtr, incoming, messageType)
+				}
+				capacity := roomPtr.Settings.Capacity
 				s.Lock.Unlock()
-				sendFail(conn, messageType, "join", "Already joined another room.")
+
+				if !queued {
+					sendFailDetails(conn, messageType, incoming, protocol.ErrRoomFull, "The room is full.",
+						map[string]any{"capacity": capacity, "queue": queueOn})
+					continue
+				}
+				mlog.Info("queued for room", "room", position.Room, "position", position.Position)
+				sendResponse(conn, messageType, incoming, protocol.TypeQueued, position)
 				continue
 			}
 
-			pPtr.Snake = createdSnake
-			pPtr.Room = roomPtr
-			roomPtr.Players = append(roomPtr.Players, pPtr)
+			createdSnake := addToRoom(roomPtr, pPtr)
 
 			// capture values for logging and response while still under lock
 			logRoomID := roomPtr.UniqeID
 			totalPlayers := len(roomPtr.Players)
 			// prepare response data (snake)
-			createdSnakeCopy := *createdSnake
+			createdSnakeCopy := wireSnake(createdSnake)
+			status := roomStatus(roomPtr)
+			settings := wireSettings(roomPtr.Settings)
 			s.Lock.Unlock()
 
-			log.Printf("Player %d (%s) joined room %s. Total players: %d\n", pPtr.ID, pPtr.Name, logRoomID, totalPlayers)
+			mlog.Info("joined room", "room", logRoomID, "players", totalPlayers)
 
-			ret := map[string]any{"response": "join", "type": "snake", "data": createdSnakeCopy}
-			jsonBytes, _ := json.Marshal(ret)
-			_ = conn.WriteMessage(messageType, jsonBytes)
+			sendResponse(conn, messageType, incoming, protocol.TypeSnake, createdSnakeCopy)
+			// the lobby or a paused match look just like a stuck game otherwise
+			sendEvent(conn, protocol.EventState, status)
+			// only the creator got the arena size with the room response
+			sendEvent(conn, protocol.EventSettings, settings)
 
-		case "disconnect":
+		case protocol.TypeDisconnect:
 			s.Lock.Lock()
 			if pPtr == nil {
 				s.Lock.Unlock()
-				sendFail(conn, messageType, "disconnect", "Connect first to access disconnect.")
+				sendFail(conn, messageType, incoming, protocol.ErrNotConnected, "Connect first to access disconnect.")
+				continue
+			}
+			if pPtr.Room == nil && leaveQueue(pPtr) {
+				s.Lock.Unlock()
+				sendResponse(conn, messageType, incoming, protocol.TypeOk, true)
 				continue
 			}
 			if pPtr.Room == nil {
 				s.Lock.Unlock()
-				sendFail(conn, messageType, "disconnect", "Join first to disconnect.")
+				sendFail(conn, messageType, incoming, protocol.ErrNotInRoom, "Join first to disconnect.")
 				continue
 			}
 			var index int = -1
@@ -275,99 +546,175 @@ func (s *Server) handleConnection(w http.ResponseWriter, r *http.Request) {
 				pPtr.Room = nil
 			} else {
 				s.Lock.Unlock()
-				sendFail(conn, messageType, "disconnect", "Failed to disconnect the player.")
+				sendFail(conn, messageType, incoming, protocol.ErrInternal, "Failed to disconnect the player.")
 				continue
 			}
 			s.Lock.Unlock()
 
-			ret := map[string]any{"response": "disconnect", "type": "ok", "data": true}
-			jsonBytes, _ := json.Marshal(ret)
-			_ = conn.WriteMessage(messageType, jsonBytes)
+			sendResponse(conn, messageType, incoming, protocol.TypeOk, true)
+
+		case protocol.TypeResync:
+			// client detected a gap in the delta stream, send a full snapshot next tick
+			if pPtr == nil {
+				sendFail(conn, messageType, incoming, protocol.ErrNotConnected, "Connect first to access resync.")
+				continue
+			}
+			s.Lock.Lock()
+			pPtr.Sync.Resync = true
+			s.Lock.Unlock()
 
-		case "input":
-			if pPtr == nil || pPtr.Snake == nil {
+		case protocol.TypeInput:
+			if pPtr == nil {
+				sendFail(conn, messageType, incoming, protocol.ErrNotConnected, "Connect first to access input.")
 				continue
 			}
-			var rdata struct {
-				Direction int `json:"dir"`
+			if pPtr.Snake == nil {
+				sendFail(conn, messageType, incoming, protocol.ErrNotInRoom, "Join a room first to send input.")
+				continue
 			}
+			var rdata protocol.InputRequest
 			if err := json.Unmarshal(incoming.Data, &rdata); err != nil {
-				sendFail(conn, messageType, "input", "Failed to parse input data")
+				sendFail(conn, messageType, incoming, protocol.ErrBadPayload, "Failed to parse input data")
+				continue
+			}
+			if rdata.Dir < 0 || rdata.Dir >= DIRECTIONS {
+				sendFail(conn, messageType, incoming, protocol.ErrBadPayload, fmt.Sprintf("Unknown direction %d, use 0 to %d.", rdata.Dir, DIRECTIONS-1))
 				continue
 			}
 			// Protect mutation of direction with the server lock to avoid racing with updateGame
 			s.Lock.Lock()
-			if (pPtr.Snake.Direction+2)%4 != int(rdata.Direction) || pPtr.Snake.BodyLen <= 1 {
-				pPtr.Snake.Direction = int(rdata.Direction)
+			if pPtr.Snake != nil {
+				s.applyInput(pPtr, rdata.Dir, rdata.Tick)
 			}
 			s.Lock.Unlock()
 
 		default:
-			// ignore unknown messages
+			sendFail(conn, messageType, incoming, protocol.ErrUnknownType, fmt.Sprintf("Unknown message type %q.", incoming.Type))
 		}
 
 		// perform any queued writes (none in current switch branches, but kept for pattern)
 		for _, wj := range toWrite {
 			if wj.conn != nil && wj.msg != nil {
-				_ = wj.conn.WriteMessage(wj.msgType, wj.msg)
+				_ = wj.conn.send(wj.kind, wj.msgType, wj.msg)
 			}
 		}
 	}
-	if pPtr != nil {
-		s.Lock.Lock()
+	s.Lock.Lock()
+	// a player that reconnected on another socket is no longer ours to detach
+	if pPtr != nil && pPtr.Socket == conn {
+		// a queued player can't be admitted without a socket
+		leaveQueue(pPtr)
 		pPtr.Socket = nil
 		pPtr.LastActive = time.Now()
-		s.Lock.Unlock()
 	}
-	log.Printf("Connection handler exiting for player: %v\n", pPtr)
+	s.Lock.Unlock()
+}
+
+// Send pings until stop is closed, a failed ping closes the connection so the reader exits
+func (s *Server) pingLoop(conn *Conn, stop <-chan struct{}) {
+	ticker := time.NewTicker(s.PingInterval)
+	defer ticker.Stop()
+
+	// measure the round trip right away instead of waiting a whole interval
+	if err := conn.ping(); err != nil {
+		_ = conn.Close()
+		return
+	}
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if err := conn.ping(); err != nil {
+				wsLog.Debug("ping failed, closing connection", "remote", conn.RemoteAddr().String(), "err", err)
+				_ = conn.Close()
+				return
+			}
+		}
+	}
 }
 
 // Some function to clean up inactive players and update game state
 func (s *Server) cleanUpService() {
-	ticker := time.NewTicker(10 * time.Second)
+	ticker := time.NewTicker(s.CleanupInterval)
 	defer ticker.Stop()
 
-	for range ticker.C {
+	evicted := 0
+	lastReport := time.Now()
+
+	for {
+		select {
+		case <-s.quit:
+			return
+		case <-ticker.C:
+		}
 		s.Lock.Lock()
-		for i := range s.PlayerConn {
-			p := s.PlayerConn[i]
-			now := time.Now()
+		now := time.Now()
+		for _, p := range s.Players {
 			if p.Socket != nil {
 				// still connected
 				continue
 			}
-			if now.After(p.LastActive.Add(PLAYER_TIMEOUT)) {
-				if p.Room != nil {
-					// remove player from its room
-					for j := range p.Room.Players {
-						if p.ID == p.Room.Players[j].ID {
-							p.Room.Players = append(p.Room.Players[:j], p.Room.Players[j+1:]...)
-							break
-						}
-					}
-					p.Room = nil
-				}
-				// optional: you could also remove the Player from s.PlayerConn here (left as-is)
+			if now.After(p.LastActive.Add(s.PlayerTimeout)) {
+				s.evictPlayer(p)
+				evicted++
+			}
+		}
+		for addr := range s.Bans {
+			s.banned(addr) // drops it once expired
+		}
+		for addr, l := range s.JoinFails {
+			if l.stale(now) {
+				delete(s.JoinFails, addr)
 			}
 		}
+		players, rooms := len(s.Players), len(s.Rooms)
 		s.Lock.Unlock()
+
+		if now.Sub(lastReport) >= s.EvictionReport {
+			cleanupLog.Info("eviction report", "evicted", evicted, "period", now.Sub(lastReport).Round(time.Second), "players", players, "rooms", rooms)
+			evicted = 0
+			lastReport = now
+		}
 	}
 }
 
-// Game update loop
+// Game update loop, every room ticks at its own Settings.TickInterval
 func (s *Server) updateGame() {
-	ticker := time.NewTicker(150 * time.Millisecond)
-	defer ticker.Stop()
+	timer := time.NewTimer(s.TickInterval)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-s.quit:
+			return
+		case <-timer.C:
+		}
+		now := time.Now()
+		s.LastLoop.Store(now.UnixNano())
+		// wake up at least once per default interval so new rooms start ticking
+		wake := now.Add(s.TickInterval)
 
-	for range ticker.C {
 		// We'll collect outgoing messages and perform writes after unlocking
 		var writeJobs []writeJob
 
 		s.Lock.Lock()
 		var emptyRooms []string
 
-		for i := range s.Room {
-			room := &s.Room[i]
+		for _, room := range s.Rooms {
+			if room.NextTick.After(now) {
+				wake = earliest(wake, room.NextTick)
+				continue
+			}
+			room.NextTick = room.NextTick.Add(room.Settings.TickInterval)
+			if !room.NextTick.After(now) {
+				// new room or the loop fell behind, don't try to catch up
+				room.NextTick = now.Add(room.Settings.TickInterval)
+			}
+			wake = earliest(wake, room.NextTick)
+
+			tickStart := time.Now()
 			var alivePlayers []*Player
 			var deadPlayers []*Player
 
@@ -382,8 +729,26 @@ func (s *Server) updateGame() {
 					continue
 				}
 
+				if p.Socket == nil {
+					// freeze the snake while its player may still reconnect
+					if time.Since(p.LastActive) < s.DisconnectGrace {
+						alivePlayers = append(alivePlayers, p)
+						continue
+					}
+					p.Snake.Dead = true
+					deadPlayers = append(deadPlayers, p)
+					continue
+				}
+
+				if room.State != protocol.RoomPlaying {
+					// lobby or paused, the board stays as it is
+					alivePlayers = append(alivePlayers, p)
+					continue
+				}
+
 				// run game logic under lock
-				p.Snake.move()
+				p.Snake.Prev = moveRecord{Tick: room.Tick + 1, Body: p.Snake.Body, BodyLen: p.Snake.BodyLen, Direction: p.Snake.Direction}
+				p.Snake.move(room.Settings.ArenaWidth, room.Settings.ArenaHeight)
 				p.Snake.checkSelfCollision()
 				s.checkFoodCollision(p)
 				s.checkSnakesCollision(p)
@@ -396,14 +761,14 @@ func (s *Server) updateGame() {
 			}
 
 			for _, p := range deadPlayers {
-				ret := map[string]any{
-					"type": "broadcast_snake_ded",
-					"data": p,
+				if p.Snake != nil {
+					s.Metrics.Deaths.Add(1)
+					gameLog.Debug("snake died", "player", p.ID, "room", room.UniqeID, "score", playerScore(p))
 				}
-				jsonBytes, _ := json.Marshal(ret)
+				jsonBytes, _ := json.Marshal(protocol.Event{Type: protocol.EventSnakeDead, Data: playerView(p)})
 				if p.Socket != nil {
 					// capture socket and message for later writing outside lock
-					writeJobs = append(writeJobs, writeJob{conn: p.Socket, msgType: websocket.TextMessage, msg: jsonBytes})
+					writeJobs = append(writeJobs, writeJob{conn: p.Socket, msgType: websocket.TextMessage, msg: jsonBytes, kind: protocol.EventSnakeDead})
 				}
 
 				p.Room = nil
@@ -411,6 +776,9 @@ func (s *Server) updateGame() {
 			}
 
 			room.Players = alivePlayers
+			writeJobs = append(writeJobs, s.admitQueued(room)...)
+			writeJobs = append(writeJobs, s.migrateHost(room)...)
+			writeJobs = append(writeJobs, s.lobbyTick(room, now)...)
 
 			for len(room.Foods) < len(room.Players) {
 				s.spawnFood(room)
@@ -421,58 +789,151 @@ func (s *Server) updateGame() {
 				continue
 			}
 
-			roomBroadcast := map[string]any{
-				"type": "broadcast_room",
-				"data": map[string]any{
-					"snakes": room.Players,
-					"foods":  room.Foods,
-				},
-			}
-			jsonBytes, _ := json.Marshal(roomBroadcast)
+			room.Tick++
+			room.TickAt = time.Now()
+			frame := captureFrame(room)
+
+			// encode the snapshot and the delta only if some client needs it
+			var snapshotBytes, deltaBytes, snapshotBin, deltaBin []byte
+			var delta *protocol.RoomDelta
 			for _, p := range room.Players {
-				if p.Socket != nil {
-					writeJobs = append(writeJobs, writeJob{conn: p.Socket, msgType: websocket.TextMessage, msg: jsonBytes})
+				if p.Socket == nil {
+					continue
+				}
+				binaryConn := p.Socket.Subprotocol() == SUBPROTOCOL_BINARY
+				msgType := websocket.TextMessage
+				if binaryConn {
+					msgType = websocket.BinaryMessage
+				}
+
+				var msg []byte
+				kind := protocol.EventRoom
+				if p.Sync.needsKeyframe(room.Tick) || room.Frame == nil {
+					switch {
+					case binaryConn && snapshotBin == nil:
+						snapshotBin = encodeSnapshot(roomSnapshot(room))
+					case !binaryConn && snapshotBytes == nil:
+						snapshotBytes, _ = json.Marshal(protocol.Event{Type: protocol.EventRoom, Data: roomSnapshot(room)})
+					}
+					msg = snapshotBytes
+					if binaryConn {
+						msg = snapshotBin
+					}
+				} else {
+					kind = protocol.EventDelta
+					if delta == nil {
+						d := diffFrames(room.Frame, frame, room)
+						delta = &d
+					}
+					switch {
+					case binaryConn && deltaBin == nil:
+						deltaBin = encodeDelta(*delta)
+					case !binaryConn && deltaBytes == nil:
+						deltaBytes, _ = json.Marshal(protocol.Event{Type: protocol.EventDelta, Data: delta})
+					}
+					msg = deltaBytes
+					if binaryConn {
+						msg = deltaBin
+					}
 				}
+				p.Sync.LastTick = room.Tick
+				p.Sync.Resync = false
+				writeJobs = append(writeJobs, writeJob{conn: p.Socket, msgType: msgType, msg: msg, kind: kind, player: p})
 			}
+			// spectators always get the full board
+			if len(room.Spectators) > 0 && snapshotBytes == nil {
+				snapshotBytes, _ = json.Marshal(protocol.Event{Type: protocol.EventRoom, Data: roomSnapshot(room)})
+			}
+			for c := range room.Spectators {
+				writeJobs = append(writeJobs, writeJob{conn: c, msgType: websocket.TextMessage, msg: snapshotBytes, kind: protocol.EventRoom})
+			}
+			room.Frame = frame
+			room.TickCost = time.Since(tickStart)
+			s.Metrics.observeTick(room.TickCost)
 		}
 
-		// remove empty rooms - iterate backwards to avoid index shifting issues
+		// remove empty rooms
+		var spectators []*Conn
 		for _, eroom := range emptyRooms {
-			for i := len(s.Room) - 1; i >= 0; i-- {
-				if eroom == s.Room[i].UniqeID {
-					s.Room = append(s.Room[:i], s.Room[i+1:]...)
-				}
-			}
+			spectators = append(spectators, s.removeRoom(s.Rooms[eroom])...)
+			gameLog.Info("room closed, no players left", "room", eroom)
 		}
 
 		s.Lock.Unlock()
 
+		for _, c := range spectators {
+			c.closeWith(websocket.CloseNormalClosure, "room closed")
+		}
+
 		// perform writes outside the lock
+		var missed []*Player
 		for _, wj := range writeJobs {
 			if wj.conn != nil && wj.msg != nil {
-				_ = wj.conn.WriteMessage(wj.msgType, wj.msg)
+				if err := wj.conn.send(wj.kind, wj.msgType, wj.msg); err != nil && wj.player != nil {
+					s.Metrics.DroppedFrames.Add(1)
+					missed = append(missed, wj.player)
+				}
+			}
+		}
+
+		// clients that missed a frame lost their baseline
+		if len(missed) > 0 {
+			s.Lock.Lock()
+			for _, p := range missed {
+				p.Sync.Resync = true
 			}
+			s.Lock.Unlock()
 		}
+
+		timer.Reset(time.Until(wake))
 	}
 }
 
-// Broadcast failure message
-func sendFail(conn *websocket.Conn, msgType int, responseTo string, reason string) {
-	state := map[string]any{
-		"response": responseTo,
-		"type":     "fail",
-		"data":     reason,
+func earliest(a, b time.Time) time.Time {
+	if b.Before(a) {
+		return b
 	}
-	jsonBytes, _ := json.Marshal(state)
-	_ = conn.WriteMessage(msgType, jsonBytes)
+	return a
+}
+
+// Reply to a client request, echoing its type and request id
+func sendResponse(conn *Conn, msgType int, req protocol.Envelope, dataType string, data any) {
+	jsonBytes, _ := json.Marshal(protocol.Response{
+		Response:  req.Type,
+		RequestID: req.RequestID,
+		Type:      dataType,
+		Data:      data,
+	})
+	_ = conn.send(dataType, msgType, jsonBytes)
+}
+
+// Push an event to one client
+func sendEvent(conn *Conn, typ string, data any) {
+	jsonBytes, _ := json.Marshal(protocol.Event{Type: typ, Data: data})
+	_ = conn.send(typ, websocket.TextMessage, jsonBytes)
+}
+
+// Broadcast failure message
+func sendFail(conn *Conn, msgType int, req protocol.Envelope, code string, reason string) {
+	sendFailDetails(conn, msgType, req, code, reason, nil)
+}
+
+// Broadcast failure message with extra machine readable details
+func sendFailDetails(conn *Conn, msgType int, req protocol.Envelope, code string, reason string, details map[string]any) {
+	sendResponse(conn, msgType, req, protocol.TypeFail, protocol.Fail{
+		Code:    code,
+		Message: reason,
+		Context: req.Type,
+		Details: details,
+	})
 }
 
 // Spawn food in the room
 func (s *Server) spawnFood(room *Room) {
 	f := Food{
 		Position: Vector2{
-			X: rand.Intn(ARENA_SIZEX),
-			Y: rand.Intn(ARENA_SIZEY),
+			X: rand.Intn(room.Settings.ArenaWidth),
+			Y: rand.Intn(room.Settings.ArenaHeight),
 		},
 	}
 	room.Foods = append(room.Foods, f)
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"time"
+)
+
+// How long a session token stays valid, every reconnect issues a fresh one
+const SESSION_TTL = 24 * time.Hour
+
+// New random session token, 256 bits from crypto/rand
+func newSessionToken() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		// crypto/rand never fails on supported platforms
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// Give the player a new token valid for ttl, the old one stops working (call under lock)
+func (p *Player) rotateToken(ttl time.Duration) {
+	p.Token = newSessionToken()
+	p.TokenExpires = time.Now().Add(ttl)
+}
+
+// Check a token presented on reconnect in constant time (call under lock)
+func (p *Player) validToken(token string) bool {
+	if p.Token == "" || time.Now().After(p.TokenExpires) {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(p.Token), []byte(token)) == 1
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"cacing/protocol"
+)
+
+func TestReconnectKeepsNewSocket(t *testing.T) {
+	s, url := newTestServer(t)
+
+	old := dialClient(t, url, "", protocol.ConnectRequest{Name: "old"})
+	old.send(t, protocol.TypeCreate, nil)
+	old.reply(t, protocol.TypeCreate)
+
+	// reconnect while the old socket is still open, the server closes it
+	c := dialSocket(t, url, "")
+	c.send(t, protocol.TypeReconnect, protocol.ReconnectRequest{ID: old.id, Token: old.token})
+	var info protocol.PlayerInfo
+	json.Unmarshal(c.reply(t, protocol.TypeReconnect).Data.(json.RawMessage), &info)
+	if info.Resume == nil {
+		t.Fatal("reconnect did not resume the room")
+	}
+	old.conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		if _, _, err := old.conn.ReadMessage(); err != nil {
+			break
+		}
+	}
+
+	// the handler of the old socket is gone once the server forgot its socket
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		s.Lock.Lock()
+		sockets := len(s.Sockets)
+		attached := s.Players[old.id].Socket != nil
+		s.Lock.Unlock()
+		if !attached {
+			t.Fatal("closing the old socket detached the reconnected player")
+		}
+		if sockets == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d sockets still open", sockets)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	c.event(t, protocol.EventRoom, &json.RawMessage{})
+}
+
+func TestOnePlayerPerSocket(t *testing.T) {
+	s, url := newTestServer(t)
+
+	c := dialClient(t, url, "", protocol.ConnectRequest{Name: "c"})
+	c.send(t, protocol.TypeConnect, protocol.ConnectRequest{Name: "again"})
+	if got := failCode(c.reply(t, protocol.TypeConnect)); got != protocol.ErrAlreadyConnected {
+		t.Fatalf("second connect: got %q", got)
+	}
+	c.send(t, protocol.TypeReconnect, protocol.ReconnectRequest{ID: c.id, Token: c.token})
+	if got := failCode(c.reply(t, protocol.TypeReconnect)); got != protocol.ErrAlreadyConnected {
+		t.Fatalf("reconnect: got %q", got)
+	}
+
+	s.Lock.Lock()
+	players := len(s.Players)
+	s.Lock.Unlock()
+	if players != 1 {
+		t.Fatalf("%d players for one socket", players)
+	}
+}
+
+func TestSessionToken(t *testing.T) {
+	p := &Player{}
+	if p.validToken("") {
+		t.Fatal("a player without a token accepted the empty token")
+	}
+	p.rotateToken(time.Minute)
+	old := p.Token
+	if !p.validToken(old) || p.validToken(old+"x") || p.validToken("") {
+		t.Fatal("token check accepts the wrong tokens")
+	}
+
+	// every reconnect rotates the token, the old one is spent
+	p.rotateToken(time.Minute)
+	if p.validToken(old) || !p.validToken(p.Token) || p.Token == old {
+		t.Error("old token still valid after rotating")
+	}
+
+	p.TokenExpires = time.Now().Add(-time.Second)
+	if p.validToken(p.Token) {
+		t.Error("expired token accepted")
+	}
+}
+
+func TestReconnectRotatesToken(t *testing.T) {
+	_, url := newTestServer(t)
+	first := dialClient(t, url, "", protocol.ConnectRequest{Name: "p"})
+	first.conn.Close()
+
+	c := dialSocket(t, url, "")
+	c.send(t, protocol.TypeReconnect, protocol.ReconnectRequest{ID: first.id, Token: first.token})
+	var info protocol.PlayerInfo
+	json.Unmarshal(c.reply(t, protocol.TypeReconnect).Data.(json.RawMessage), &info)
+	if info.Token == "" || info.Token == first.token {
+		t.Fatalf("reconnect kept the token: %q", info.Token)
+	}
+
+	again := dialSocket(t, url, "")
+	again.send(t, protocol.TypeReconnect, protocol.ReconnectRequest{ID: first.id, Token: first.token})
+	if got := failCode(again.reply(t, protocol.TypeReconnect)); got != protocol.ErrReconnectFailed {
+		t.Errorf("spent token: got %q", got)
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"cacing/protocol"
+)
+
+// Default time running matches get to finish after a shutdown signal
+const SHUTDOWN_TIMEOUT = 30 * time.Second
+
+// How often server_shutdown is sent while draining
+const SHUTDOWN_NOTICE_INTERVAL = time.Second
+
+// Run the game loops, stop() waits for them to return
+func (s *Server) start() {
+	s.LastLoop.Store(time.Now().UnixNano())
+	s.loops.Add(2)
+	go func() {
+		defer s.loops.Done()
+		s.updateGame()
+	}()
+	go func() {
+		defer s.loops.Done()
+		s.cleanUpService()
+	}()
+}
+
+// Register a hook that runs once the game loops stopped, to flush anything
+// that must outlive the process (replays, leaderboards, ...)
+func (s *Server) onShutdown(hook func(ctx context.Context) error) {
+	s.Lock.Lock()
+	s.ShutdownHooks = append(s.ShutdownHooks, hook)
+	s.Lock.Unlock()
+}
+
+// Stop accepting new rooms and joins, close the rooms that haven't started and
+// let running matches play until they end or the timeout runs out, telling
+// every client how long is left
+func (s *Server) drain(timeout time.Duration) {
+	deadline := time.Now().Add(timeout)
+	s.Lock.Lock()
+	s.Draining = true
+	var jobs []writeJob
+	var spectators []*Conn
+	closed := 0
+	for _, room := range s.Rooms {
+		// a lobby would only end with the deadline
+		if room.State == protocol.RoomLobby || room.State == protocol.RoomStarting {
+			j, c := s.closeRoom(room, "The server is restarting.")
+			jobs, spectators = append(jobs, j...), append(spectators, c...)
+			closed++
+		}
+	}
+	s.Lock.Unlock()
+	for _, wj := range jobs {
+		_ = wj.conn.send(wj.kind, wj.msgType, wj.msg)
+	}
+	for _, c := range spectators {
+		c.closeWith(websocket.CloseNormalClosure, "room closed")
+	}
+	serverLog.Info("draining: no new rooms or joins", "deadline", deadline.Format(time.TimeOnly), "closed_lobbies", closed)
+
+	ticker := time.NewTicker(SHUTDOWN_NOTICE_INTERVAL)
+	defer ticker.Stop()
+	for {
+		s.Lock.Lock()
+		rooms := len(s.Rooms)
+		jobs := s.shutdownNotice(deadline)
+		s.Lock.Unlock()
+
+		for _, wj := range jobs {
+			_ = wj.conn.send(wj.kind, wj.msgType, wj.msg)
+		}
+		if rooms == 0 {
+			serverLog.Info("draining: every match ended")
+			return
+		}
+		if !time.Now().Before(deadline) {
+			serverLog.Warn("draining: deadline reached", "rooms", rooms)
+			return
+		}
+		<-ticker.C
+	}
+}
+
+// server_shutdown for every connected player (call under lock)
+func (s *Server) shutdownNotice(deadline time.Time) []writeJob {
+	left := time.Until(deadline).Round(time.Second)
+	if left < 0 {
+		left = 0
+	}
+	msg, _ := json.Marshal(protocol.Event{Type: protocol.EventShutdown, Data: protocol.ServerShutdown{
+		Reason:      "The server is restarting.",
+		Deadline:    deadline.UnixMilli(),
+		SecondsLeft: int(left / time.Second),
+	}})
+
+	var jobs []writeJob
+	for _, p := range s.Players {
+		if p.Socket != nil {
+			jobs = append(jobs, writeJob{conn: p.Socket, msgType: websocket.TextMessage, msg: msg, kind: protocol.EventShutdown})
+		}
+	}
+	return jobs
+}
+
+// Stop the game loops, run the shutdown hooks and close every socket with
+// 1001 (going away). Call after the HTTP server stopped accepting connections.
+func (s *Server) stop(ctx context.Context) {
+	close(s.quit)
+	s.loops.Wait()
+
+	s.Lock.Lock()
+	hooks := s.ShutdownHooks
+	s.Lock.Unlock()
+	for _, hook := range hooks {
+		if err := hook(ctx); err != nil {
+			serverLog.Error("shutdown hook failed", "err", err)
+		}
+	}
+
+	s.Lock.Lock()
+	conns := make([]*Conn, 0, len(s.Sockets))
+	for c := range s.Sockets {
+		conns = append(conns, c)
+	}
+	s.Lock.Unlock()
+	for _, c := range conns {
+		c.closeWith(websocket.CloseGoingAway, "server shutdown")
+	}
+	serverLog.Info("closed sockets", "sockets", len(conns))
+}
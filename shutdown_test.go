@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"cacing/protocol"
+)
+
+func TestDrainAndStop(t *testing.T) {
+	// stop is part of the test, so no newTestServer
+	s := newServer(defaultConfig())
+	s.Countdown = 0
+	url := serveTest(t, s)
+
+	waiting := dialClient(t, url, "", protocol.ConnectRequest{Name: "waiting"})
+	waiting.send(t, protocol.TypeCreate, nil)
+	waiting.reply(t, protocol.TypeCreate)
+
+	playing := dialClient(t, url, "", protocol.ConnectRequest{Name: "playing"})
+	playing.send(t, protocol.TypeCreate, nil)
+	var match protocol.Room
+	json.Unmarshal(playing.reply(t, protocol.TypeCreate).Data.(json.RawMessage), &match)
+	playing.send(t, protocol.TypeStart, nil)
+	var status protocol.RoomStatus
+	for status.State != protocol.RoomPlaying {
+		playing.event(t, protocol.EventState, &status)
+	}
+
+	drained := make(chan struct{})
+	go func() {
+		s.drain(time.Minute)
+		close(drained)
+	}()
+
+	// the lobby closes right away, the match keeps running
+	var closed protocol.RoomClosed
+	waiting.event(t, protocol.EventClosed, &closed)
+	var notice protocol.ServerShutdown
+	playing.event(t, protocol.EventShutdown, &notice)
+	if notice.SecondsLeft < 50 {
+		t.Errorf("shutdown notice: %+v", notice)
+	}
+	waiting.send(t, protocol.TypeJoin, protocol.JoinRequest{Room: match.ID})
+	if got := failCode(waiting.reply(t, protocol.TypeJoin)); got != protocol.ErrShuttingDown {
+		t.Errorf("join while draining: got %q", got)
+	}
+	waiting.send(t, protocol.TypeCreate, nil)
+	if got := failCode(waiting.reply(t, protocol.TypeCreate)); got != protocol.ErrShuttingDown {
+		t.Errorf("create while draining: got %q", got)
+	}
+	select {
+	case <-drained:
+		t.Fatal("drain returned while a match was running")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// the last match ends, drain is done long before the timeout
+	playing.send(t, protocol.TypeDisconnect, nil)
+	select {
+	case <-drained:
+	case <-time.After(5 * time.Second):
+		t.Fatal("drain still waiting after every match ended")
+	}
+
+	s.stop(context.Background())
+	for {
+		playing.conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		_, _, err := playing.conn.ReadMessage()
+		var ce *websocket.CloseError
+		if errors.As(err, &ce) {
+			if ce.Code != websocket.CloseGoingAway {
+				t.Errorf("closed with %d", ce.Code)
+			}
+			break
+		}
+		if err != nil {
+			t.Fatalf("socket not closed by stop: %v", err)
+		}
+	}
+}
@@ -1,5 +1,7 @@
 package main
 
+import "math/rand"
+
 // Vector2 struct
 type Vector2 struct {
 	X int `json:"x"`
@@ -8,15 +10,45 @@ type Vector2 struct {
 
 // Snake struct
 type Snake struct {
-	Body       []Vector2 `json:"body"`
-	BodyLen    int       `json:"body_len"`
-	Direction  int       `json:"dir"`
-	Color      string    `json:"color"`
-	Dead       bool      `json:"dead"`
+	Body       []Vector2  `json:"body"`
+	BodyLen    int        `json:"body_len"`
+	Direction  int        `json:"dir"`
+	Color      string     `json:"color"`
+	Dead       bool       `json:"dead"`
+	Prev       moveRecord `json:"-"`
 };
 
-// Move the snake based on its current direction
-func (s *Snake) move() {
+// New one cell snake somewhere in an arena of these settings
+func newSnake(settings RoomSettings) *Snake {
+	return &Snake{
+		Body:      []Vector2{{X: rand.Intn(settings.ArenaWidth), Y: rand.Intn(settings.ArenaHeight)}},
+		BodyLen:   1,
+		Color:     generate_random_color(),
+		Direction: rand.Intn(4),
+	}
+}
+
+// Whether every segment lies inside a width x height arena
+func (s *Snake) inside(width, height int) bool {
+	for _, seg := range s.Body {
+		if seg.X < 0 || seg.X >= width || seg.Y < 0 || seg.Y >= height { return false }
+	}
+	return true
+}
+
+// Put the snake back on one random cell of an arena of these settings, it keeps
+// its length and grows back to it over the next moves
+func (s *Snake) respawn(settings RoomSettings) {
+	s.Body = []Vector2{{X: rand.Intn(settings.ArenaWidth), Y: rand.Intn(settings.ArenaHeight)}}
+	// a late input must not rewind it to where it was
+	s.Prev = moveRecord{}
+}
+
+// Move the snake based on its current direction, wrapping around a width x height arena
+// Directions are 0 right, 1 down, 2 left and 3 up
+const DIRECTIONS = 4
+
+func (s *Snake) move(width, height int) {
 	if len(s.Body) == 0 { return }
 	head := s.Body[0]
 	switch s.Direction {
@@ -30,10 +62,10 @@ func (s *Snake) move() {
 		head.Y -= 1
 	}
 
-	if head.X >= ARENA_SIZEX { head.X = 0 }
-	if head.X < 0            { head.X = ARENA_SIZEX - 1 }
-	if head.Y >= ARENA_SIZEY { head.Y = 0 }
-	if head.Y < 0            { head.Y = ARENA_SIZEY - 1 }
+	if head.X >= width  { head.X = 0 }
+	if head.X < 0       { head.X = width - 1 }
+	if head.Y >= height { head.Y = 0 }
+	if head.Y < 0       { head.Y = height - 1 }
 
 	s.Body = append([]Vector2{head}, s.Body...)
 	for len(s.Body) > s.BodyLen {
@@ -1,23 +1,30 @@
+// Plain JS client served by the binary when the React app wasn't built.
+// Speaks the same JSON protocol as frontend/snake-frontend (see protocol/).
+
 // ========================================
 // RENDER FUNCTIONS
 // ========================================
-function renderSnake(ctx, item) {
-    ctx.fillStyle = item.color;
-    item.body.forEach(segment => {
+function renderSnake(ctx, player) {
+    const snake = player.snake;
+    if (!snake) return;
+    ctx.globalAlpha = snake.dead || (player.flags || []).includes("disconnected") ? 0.4 : 1;
+    ctx.fillStyle = snake.color;
+    snake.body.forEach(segment => {
         ctx.fillRect(segment.x, segment.y, 1, 1);
     });
+    ctx.globalAlpha = 1;
 }
 
 function renderFood(ctx, foods) {
     ctx.fillStyle = 'red';
     foods.forEach(f => {
-        ctx.fillRect(f.x, f.y, 1, 1);
+        ctx.fillRect(f.pos.x, f.pos.y, 1, 1);
     });
 }
 
-function sendToWS(ws, data) {
+function sendToWS(ws, type, data) {
     if (ws.readyState === WebSocket.OPEN) {
-        ws.send(JSON.stringify(data));
+        ws.send(JSON.stringify({ type, data }));
     } else {
         console.warn("WebSocket not open:", ws.readyState);
     }
@@ -28,17 +35,53 @@ function sendToWS(ws, data) {
 // ========================================
 document.addEventListener("DOMContentLoaded", () => {
     const idDisplay = document.getElementById('snake_id');
+    const statusDisplay = document.getElementById('status');
     const canvas = document.getElementById('canvas');
     const ctx = canvas.getContext('2d');
-    const scale = 16;
-    const snakes = [];
-    const foods = [];
-    let player_id = -1;
+    const PROTOCOL_VERSION = 1;
+    let snakes = [];
+    let foods = [];
+    let player = null;
+    let room = null;
+    let state = null;
+    let ready = false;
+
+    function setArena(settings) {
+        canvas.width = settings.arena_width;
+        canvas.height = settings.arena_height;
+    }
+
+    function showStatus(countdown) {
+        if (!room) {
+            statusDisplay.innerText = "";
+        } else if (countdown !== undefined) {
+            statusDisplay.innerText = `Room ${room}: starting in ${countdown}`;
+        } else if (state && state.state === "lobby") {
+            const host = player && state.host === player.id ? ", S to start now" : "";
+            statusDisplay.innerText = `Room ${room}: ${ready ? "ready, waiting for the others" : "press space when ready"}${host}`;
+        } else {
+            statusDisplay.innerText = `Room ${room}` + (state && state.state !== "playing" ? `: ${state.state}` : "");
+        }
+    }
+
+    function enterRoom() {
+        const code = prompt("Room code to join (empty to create a room):");
+        if (code) {
+            room = code.toUpperCase();
+            const password = prompt("Room password (empty if none):") || "";
+            sendToWS(ws, "join", { room, password });
+        } else {
+            // private by default, like on the server
+            const password = prompt("Password for the new room (empty for none):") || "";
+            const listed = confirm("List the room in the public room list?");
+            sendToWS(ws, "create", { public: listed, password });
+        }
+    }
 
     // === CONNECT TO SERVER ===
-    const ip = prompt("Enter server IP (default: localhost):") || "localhost";
-    const port = 8080;
-    const ws = new WebSocket(`ws://${ip}:${port}/ws`);
+    // the page is served by the game server itself
+    const scheme = location.protocol === "https:" ? "wss" : "ws";
+    const ws = new WebSocket(`${scheme}://${location.host}/ws`);
 
     ws.onerror = (_) => {
         const msg = "Failed to connect to the WebSocket";
@@ -46,44 +89,80 @@ document.addEventListener("DOMContentLoaded", () => {
         alert(msg);
     };
 
+    ws.onclose = () => {
+        statusDisplay.innerText = "Disconnected, reload to play again";
+    };
+
     ws.onopen = () => {
-        // Ask if user wants to reconnect
-        const reconnectChoice = confirm("Reconnect to existing snake?");
-        if (reconnectChoice) {
-            const idInput = prompt("Enter your snake ID:");
-            const parsed = parseInt(idInput);
-            if (!isNaN(parsed)) {
-                player_id = parsed;
-                idDisplay.innerText = player_id;
-                sendToWS(ws, { type: "connect", data: String(parsed) });
-            } else {
-                alert("Invalid ID, starting new snake instead.");
-                sendToWS(ws, { type: "string", data: "ready" });
-            }
+        // the token of the last session is good for one reconnect
+        const saved = JSON.parse(sessionStorage.getItem("snakeSession") || "null");
+        if (saved) {
+            sendToWS(ws, "reconnect", saved);
         } else {
-            sendToWS(ws, { type: "string", data: "ready" });
+            sendToWS(ws, "connect", { name: prompt("Your name:") || "snake", version: PROTOCOL_VERSION });
         }
     };
 
     ws.addEventListener("message", (e) => {
-        const data = JSON.parse(e.data);
-
-        if (data.type === "p_snake") {
-            player_id = data.data.id;
-            idDisplay.innerText = player_id;
-            console.log("Assigned snake ID:", player_id);
-        } else if (data.type === "state") {
-            snakes.length = 0;
-            foods.length = 0;
-            snakes.push(...data.data.snakes);
-            foods.push(...data.data.foods);
-        } else if (data.type === "s_death") {
-            alert(`Your snake (${data.data}) died!`);
-            ctx.clearRect(0, 0, canvas.width, canvas.height);
-            ws.close();
-        } else if (data.type === "fail") {
-            alert("Failed to connect: " + data.data);
-            ws.close();
+        const msg = JSON.parse(e.data);
+
+        if (msg.type === "player") {
+            player = msg.data;
+            idDisplay.innerText = player.id;
+            sessionStorage.setItem("snakeSession", JSON.stringify({ id: player.id, token: player.token }));
+            if (player.resume) {
+                room = player.resume.room;
+                state = player.resume.status;
+                setArena(player.resume.settings);
+                snakes = player.resume.snapshot.snakes;
+                foods = player.resume.snapshot.foods;
+                showStatus();
+            } else {
+                enterRoom();
+            }
+        } else if (msg.type === "room") {
+            room = msg.data.id;
+            state = msg.data.status;
+            setArena(msg.data.settings);
+            showStatus();
+        } else if (msg.type === "queued" || msg.type === "queue_position") {
+            statusDisplay.innerText = `Room ${room} is full, you are #${msg.data.position} in line`;
+        } else if (msg.type === "room_settings") {
+            setArena(msg.data);
+        } else if (msg.type === "room_state") {
+            state = msg.data;
+            if (state.state !== "lobby" && state.state !== "starting") ready = false;
+            showStatus();
+        } else if (msg.type === "room_countdown") {
+            showStatus(msg.data.seconds_left);
+        } else if (msg.type === "broadcast_room") {
+            snakes = msg.data.snakes;
+            foods = msg.data.foods;
+        } else if (msg.type === "broadcast_snake_ded") {
+            alert(`Your snake died with a score of ${msg.data.score}!`);
+            room = null;
+            snakes = [];
+            foods = [];
+            showStatus();
+            enterRoom();
+        } else if (msg.type === "room_closed" || msg.type === "room_kicked") {
+            alert(msg.data.reason);
+            room = null;
+            showStatus();
+            enterRoom();
+        } else if (msg.type === "server_message") {
+            alert(msg.data.message);
+        } else if (msg.type === "fail") {
+            if (msg.data.code === "RECONNECT_FAILED") {
+                sessionStorage.removeItem("snakeSession");
+                sendToWS(ws, "connect", { name: prompt("Your name:") || "snake", version: PROTOCOL_VERSION });
+                return;
+            }
+            alert(msg.data.message);
+            if (msg.response === "join" || msg.response === "create") {
+                room = null;
+                enterRoom();
+            }
         }
     });
 
@@ -98,9 +177,20 @@ document.addEventListener("DOMContentLoaded", () => {
     };
 
     document.addEventListener('keydown', (event) => {
+        if (!player || !room) return;
+        if (event.key === " " && state && (state.state === "lobby" || state.state === "starting")) {
+            ready = !ready;
+            sendToWS(ws, "ready", { ready });
+            showStatus();
+            return;
+        }
+        if (event.key.toLowerCase() === "s" && state && state.state === "lobby" && state.host === player.id) {
+            sendToWS(ws, "start");
+            return;
+        }
         const new_dir = keyToDir[event.key];
-        if (new_dir === undefined || player_id === -1) return;
-        sendToWS(ws, { type: "input", id: player_id, dir: new_dir });
+        if (new_dir === undefined) return;
+        sendToWS(ws, "input", { dir: new_dir });
     });
 
     // ========================================
@@ -109,7 +199,7 @@ document.addEventListener("DOMContentLoaded", () => {
     function gameLoop() {
         ctx.clearRect(0, 0, canvas.width, canvas.height);
         renderFood(ctx, foods);
-        snakes.forEach(item => renderSnake(ctx, item));
+        snakes.forEach(p => renderSnake(ctx, p));
         requestAnimationFrame(gameLoop);
     }
 
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"runtime/debug"
+	"time"
+
+	"cacing/protocol"
+)
+
+// Build information, set with
+// go build -ldflags "-X main.VERSION=1.2.0 -X main.COMMIT=$(git rev-parse HEAD)"
+var VERSION = "dev"
+var COMMIT = ""
+
+// The game loop counts as stuck when it didn't start a tick for this many intervals
+const STALL_TICKS = 20
+
+// Commit of the build, from -ldflags or else from the VCS stamp of go build
+func buildCommit() string {
+	if COMMIT != "" {
+		return COMMIT
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range info.Settings {
+			if setting.Key == "vcs.revision" {
+				return setting.Value
+			}
+		}
+	}
+	return "unknown"
+}
+
+// GET /healthz: the process serves HTTP and the game loop still ticks
+func (s *Server) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	last := time.Unix(0, s.LastLoop.Load())
+	if stalled := time.Since(last); stalled > STALL_TICKS*s.TickInterval {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]any{"status": "game loop stalled", "since_ms": stalled.Milliseconds()})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"status": "ok"})
+}
+
+// GET /readyz: new players are welcome, false while draining for a shutdown
+func (s *Server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	s.Lock.Lock()
+	draining := s.Draining
+	s.Lock.Unlock()
+	if draining {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]any{"status": "draining"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"status": "ready"})
+}
+
+// GET /api/info
+func (s *Server) handleInfo(w http.ResponseWriter, r *http.Request) {
+	info := protocol.ServerInfo{
+		Version:            VERSION,
+		Commit:             buildCommit(),
+		ProtocolVersion:    protocol.Version,
+		MinProtocolVersion: protocol.MinVersion,
+		UptimeSeconds:      int64(time.Since(s.Started).Seconds()),
+		TickMillis:         int(s.TickInterval.Milliseconds()),
+	}
+	s.Lock.Lock()
+	info.Rooms = len(s.Rooms)
+	info.Players = len(s.Players)
+	for _, p := range s.Players {
+		if p.Socket != nil {
+			info.PlayersConnected++
+		}
+	}
+	info.Draining = s.Draining
+	s.Lock.Unlock()
+	writeJSON(w, http.StatusOK, info)
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
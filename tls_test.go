@@ -0,0 +1,27 @@
+package main
+
+import (
+	"crypto/x509"
+	"testing"
+)
+
+func TestSelfSignedCertIsLeaf(t *testing.T) {
+	dir := t.TempDir()
+	cert, err := selfSignedCert(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if leaf.IsCA || leaf.KeyUsage&x509.KeyUsageCertSign != 0 {
+		t.Errorf("dev certificate can sign certificates: ca %v, usage %b", leaf.IsCA, leaf.KeyUsage)
+	}
+	if err := leaf.VerifyHostname("localhost"); err != nil {
+		t.Error(err)
+	}
+	if !certCovers(cert, localHosts()) {
+		t.Error("fresh certificate would be generated again")
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gorilla/websocket"
+)
+
+// Largest message a client may send, inputs and requests are tiny
+const MAX_MESSAGE_SIZE = 4096
+
+// Settings of the websocket upgrader
+type UpgraderConfig struct {
+	// Origins allowed besides same-origin, "*" allows any and
+	// "https://*.example.com" any subdomain
+	AllowedOrigins    []string
+	ReadBufferSize    int
+	WriteBufferSize   int
+	EnableCompression bool
+	Subprotocols      []string
+	MaxMessageSize    int64
+}
+
+func defaultUpgraderConfig() UpgraderConfig {
+	return UpgraderConfig{
+		ReadBufferSize:  1024,
+		WriteBufferSize: 1024,
+		Subprotocols:    []string{SUBPROTOCOL_BINARY},
+		MaxMessageSize:  MAX_MESSAGE_SIZE,
+	}
+}
+
+func newUpgrader(cfg UpgraderConfig) websocket.Upgrader {
+	return websocket.Upgrader{
+		ReadBufferSize:    cfg.ReadBufferSize,
+		WriteBufferSize:   cfg.WriteBufferSize,
+		EnableCompression: cfg.EnableCompression,
+		Subprotocols:      cfg.Subprotocols,
+		CheckOrigin:       originChecker(cfg.AllowedOrigins),
+	}
+}
+
+// Accept same-origin requests, requests without Origin (non-browser clients)
+// and origins from the allowlist, log everything else
+func originChecker(allowed []string) func(r *http.Request) bool {
+	return func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			return true
+		}
+		u, err := url.Parse(origin)
+		if err == nil && strings.EqualFold(u.Host, r.Host) {
+			return true
+		}
+		for _, a := range allowed {
+			if originMatches(a, origin) {
+				return true
+			}
+		}
+		httpLog.Warn("rejected websocket: origin not same-origin and not allowed", "origin", origin, "host", r.Host, "remote", r.RemoteAddr)
+		return false
+	}
+}
+
+// Match one allowlist entry against an Origin header
+func originMatches(pattern, origin string) bool {
+	if pattern == "*" {
+		return true
+	}
+	pattern = strings.ToLower(strings.TrimSuffix(pattern, "/"))
+	origin = strings.ToLower(origin)
+	if scheme, host, ok := strings.Cut(pattern, "://*."); ok {
+		// wildcard subdomain: same scheme, host ends with .domain
+		rest, found := strings.CutPrefix(origin, scheme+"://")
+		return found && strings.HasSuffix(rest, "."+host)
+	}
+	return pattern == origin
+}
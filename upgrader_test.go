@@ -0,0 +1,57 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestOriginChecker(t *testing.T) {
+	check := originChecker([]string{"http://localhost:5173", "https://*.example.com"})
+	for _, tc := range []struct {
+		origin string
+		want   bool
+	}{
+		{"", true},
+		{"http://snake.local:8080", true},
+		{"http://localhost:5173", true},
+		{"HTTP://LOCALHOST:5173", true},
+		{"http://localhost:5174", false},
+		{"https://play.example.com", true},
+		{"https://a.b.example.com", true},
+		{"http://play.example.com", false},
+		{"https://example.com", false},
+		{"https://evilexample.com", false},
+		{"https://example.com.evil.org", false},
+		{"https://evil.org", false},
+	} {
+		r := httptest.NewRequest("GET", "http://snake.local:8080/ws", nil)
+		if tc.origin != "" {
+			r.Header.Set("Origin", tc.origin)
+		}
+		if got := check(r); got != tc.want {
+			t.Errorf("origin %q: got %v, want %v", tc.origin, got, tc.want)
+		}
+	}
+}
+
+func TestOriginMatchesAny(t *testing.T) {
+	if !originMatches("*", "https://anything.test") {
+		t.Error("* should allow any origin")
+	}
+	if !originMatches("http://localhost:5173/", "http://localhost:5173") {
+		t.Error("a trailing slash in the allowlist should not matter")
+	}
+}
+
+func TestDefaultOriginsSameOriginOnly(t *testing.T) {
+	check := originChecker(defaultConfig().upgrader().AllowedOrigins)
+	r := httptest.NewRequest("GET", "http://snake.local:8080/ws", nil)
+	r.Header.Set("Origin", "http://localhost:5173")
+	if check(r) {
+		t.Error("the vite dev origin is allowed without configuring it")
+	}
+	r.Header.Set("Origin", "http://snake.local:8080")
+	if !check(r) {
+		t.Error("same-origin refused")
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"cacing/protocol"
+)
+
+func TestBroadcastsNeverLeakSecrets(t *testing.T) {
+	_, url := newTestServer(t)
+
+	host := dialClient(t, url, "", protocol.ConnectRequest{Name: "host"})
+	delta := dialClient(t, url, "", protocol.ConnectRequest{Name: "delta", Delta: true})
+	bin := dialClient(t, url, SUBPROTOCOL_BINARY, protocol.ConnectRequest{Name: "bin", Delta: true})
+
+	host.send(t, protocol.TypeCreate, nil)
+	var created struct {
+		Data protocol.Room `json:"data"`
+	}
+	if err := json.Unmarshal(host.read(t), &created); err != nil || created.Data.ID == "" {
+		t.Fatalf("create failed: %v", err)
+	}
+	delta.send(t, protocol.TypeJoin, protocol.JoinRequest{Room: created.Data.ID})
+	bin.send(t, protocol.TypeJoin, protocol.JoinRequest{Room: created.Data.ID})
+
+	// a few ticks: keyframes, deltas and binary frames
+	for i := 0; i < 6; i++ {
+		host.read(t)
+		delta.read(t)
+		bin.read(t)
+	}
+
+	secrets := []string{host.token, delta.token, bin.token}
+	for _, c := range []*testClient{host, delta, bin} {
+		for _, frame := range c.frames {
+			for _, secret := range secrets {
+				if bytes.Contains(frame, []byte(secret)) {
+					t.Fatalf("session token leaked in frame %q", frame)
+				}
+			}
+			for _, key := range []string{`"token"`, `"token_expires"`, `"unique_id"`} {
+				if bytes.Contains(frame, []byte(key)) {
+					t.Fatalf("secret field %s in frame %q", key, frame)
+				}
+			}
+		}
+	}
+}
+
+func TestPlayerViewHasNoSecrets(t *testing.T) {
+	p := &Player{
+		ID:           1,
+		Name:         "p",
+		Token:        newSessionToken(),
+		TokenExpires: time.Now().Add(time.Hour),
+		Snake:        &Snake{Body: []Vector2{{X: 1, Y: 1}}, BodyLen: 1, Dead: true},
+	}
+	out, _ := json.Marshal(protocol.Event{Type: protocol.EventSnakeDead, Data: playerView(p)})
+	if bytes.Contains(out, []byte(p.Token)) || bytes.Contains(out, []byte("token")) {
+		t.Fatalf("player view leaks the session token: %s", out)
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"time"
+
+	"cacing/protocol"
+)
+
+// Conversions from server state to the wire types of the protocol package
+
+func wireVector(v Vector2) protocol.Vector2 {
+	return protocol.Vector2{X: v.X, Y: v.Y}
+}
+
+func wireVectors(list []Vector2) []protocol.Vector2 {
+	out := make([]protocol.Vector2, 0, len(list))
+	for _, v := range list {
+		out = append(out, wireVector(v))
+	}
+	return out
+}
+
+func wireFoods(foods []Food) []protocol.Food {
+	out := make([]protocol.Food, 0, len(foods))
+	for _, f := range foods {
+		out = append(out, protocol.Food{Pos: wireVector(f.Position)})
+	}
+	return out
+}
+
+func wireSnake(s *Snake) *protocol.Snake {
+	if s == nil {
+		return nil
+	}
+	return &protocol.Snake{
+		Body:    wireVectors(s.Body),
+		BodyLen: s.BodyLen,
+		Dir:     s.Direction,
+		Color:   s.Color,
+		Dead:    s.Dead,
+	}
+}
+
+// Public view of a player for broadcasts, built field by field so a new
+// server-only field on Player can never leak by accident
+func playerView(p *Player) protocol.PlayerView {
+	return protocol.PlayerView{
+		ID:    p.ID,
+		Name:  p.Name,
+		Snake: wireSnake(p.Snake),
+		Score: playerScore(p),
+		Flags: playerFlags(p),
+		Ping:  pingMillis(p),
+	}
+}
+
+func playerScore(p *Player) int {
+	if p.Snake == nil {
+		return 0
+	}
+	return p.Snake.BodyLen
+}
+
+func playerFlags(p *Player) []string {
+	var flags []string
+	if p.Socket == nil {
+		flags = append(flags, protocol.FlagDisconnected)
+	}
+	if p.Room != nil && p.Room.Host == p {
+		flags = append(flags, protocol.FlagHost)
+	}
+	if p.Ready && p.Room != nil && !p.Room.started() {
+		flags = append(flags, protocol.FlagReady)
+	}
+	return flags
+}
+
+func pingMillis(p *Player) int {
+	return int(p.RTT / time.Millisecond)
+}
+
+// Data of the player response, the only place the session token is sent
+func playerInfo(p *Player) protocol.PlayerInfo {
+	return protocol.PlayerInfo{
+		ID:              p.ID,
+		Name:            p.Name,
+		Token:           p.Token,
+		TokenExpires:    p.TokenExpires.Unix(),
+		ProtocolVersion: protocol.Version,
+	}
+}
+
+func playerViews(players []*Player) []protocol.PlayerView {
+	out := make([]protocol.PlayerView, 0, len(players))
+	for _, p := range players {
+		out = append(out, playerView(p))
+	}
+	return out
+}
+
+func wireSettings(rs RoomSettings) protocol.RoomSettings {
+	return protocol.RoomSettings{
+		ArenaWidth:  rs.ArenaWidth,
+		ArenaHeight: rs.ArenaHeight,
+		TickMillis:  int(rs.TickInterval / time.Millisecond),
+		Capacity:    rs.Capacity,
+		ReadyQuorum: rs.ReadyQuorum,
+	}
+}
+
+func wireRoom(r *Room) protocol.Room {
+	return protocol.Room{
+		ID:       r.UniqeID,
+		Name:     r.Name,
+		Public:   r.Public,
+		Password: r.Password != nil,
+		Queue:    r.QueueOn,
+		Status:   roomStatus(r),
+		Mode:     r.Mode,
+		Map:      r.Map,
+		Settings: wireSettings(r.Settings),
+		Players:  playerViews(r.Players),
+		Foods:    wireFoods(r.Foods),
+	}
+}
+
+func roomStatus(r *Room) protocol.RoomStatus {
+	status := protocol.RoomStatus{Room: r.UniqeID, State: r.State, Locked: r.Locked, Host: -1}
+	if r.Host != nil {
+		status.Host = r.Host.ID
+	}
+	return status
+}
+
+// Full board snapshot sent as broadcast_room (call under lock)
+func roomSnapshot(r *Room) protocol.RoomSnapshot {
+	return protocol.RoomSnapshot{
+		Tick:   r.Tick,
+		Snakes: playerViews(r.Players),
+		Foods:  wireFoods(r.Foods),
+	}
+}